@@ -0,0 +1,324 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type SymlinkPolicy int
+
+const (
+	// SymlinkWithin creates symlinks whose target stays inside the destination and rejects the others
+	SymlinkWithin SymlinkPolicy = iota
+	SymlinkSkip
+	SymlinkReject
+)
+
+type Options struct {
+	Symlinks SymlinkPolicy
+	// MaxTotalSize caps the number of bytes written, 0 means unlimited
+	MaxTotalSize int64
+	// MaxEntries caps the number of entries in the archive, 0 means unlimited
+	MaxEntries int
+	// Workers bounds the number of entries extracted concurrently, only zip archives are extracted concurrently
+	Workers int
+	// SkipUnchanged reuses files of Reference (or dest when empty) whose size and CRC32 match the entry
+	SkipUnchanged bool
+	Reference     string
+	// Progress is called after each entry, calls are serialized
+	Progress func(done int, total int)
+}
+
+var DefaultOptions = Options{
+	Symlinks:     SymlinkWithin,
+	MaxTotalSize: 2 << 30,
+	MaxEntries:   100_000,
+}
+
+var (
+	ErrIllegalPath      = errors.New("illegal path in archive")
+	ErrIllegalLink      = errors.New("illegal link in archive")
+	ErrTooLarge         = errors.New("archive exceeds the maximum extracted size")
+	ErrTooManyEntries   = errors.New("archive exceeds the maximum number of entries")
+	ErrUnsupportedEntry = errors.New("unsupported entry type in archive")
+)
+
+type extractor struct {
+	dest    string
+	opts    Options
+	entries atomic.Int64
+	written atomic.Int64
+
+	total      int
+	progressMu sync.Mutex
+	done       int
+}
+
+func newExtractor(dest string, opts Options) (*extractor, error) {
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, err
+	}
+	return &extractor{dest: dest, opts: opts}, nil
+}
+
+func (e *extractor) entry() error {
+	if n := e.entries.Add(1); e.opts.MaxEntries > 0 && n > int64(e.opts.MaxEntries) {
+		return ErrTooManyEntries
+	}
+	return nil
+}
+
+func (e *extractor) progress() {
+	if e.opts.Progress == nil {
+		return
+	}
+	e.progressMu.Lock()
+	defer e.progressMu.Unlock()
+	e.done++
+	e.opts.Progress(e.done, e.total)
+}
+
+// resolve maps an archive entry name to a path inside dest, ensuring no parent folder is a link
+func (e *extractor) resolve(name string) (string, error) {
+	if name == "" || strings.ContainsRune(name, 0) || strings.Contains(name, `\`) || path.IsAbs(name) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("%w: %q", ErrIllegalPath, name)
+	}
+
+	rel := path.Clean(name)
+	if rel == "." {
+		return e.dest, nil
+	}
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%w: %q", ErrIllegalPath, name)
+	}
+
+	p := filepath.Join(e.dest, filepath.FromSlash(rel))
+
+	parent := e.dest
+	for _, part := range strings.Split(filepath.Dir(filepath.FromSlash(rel)), string(filepath.Separator)) {
+		if part == "." {
+			break
+		}
+		parent = filepath.Join(parent, part)
+		if info, err := os.Lstat(parent); err == nil && !info.IsDir() {
+			return "", fmt.Errorf("%w: %q traverses %s", ErrIllegalPath, name, parent)
+		}
+	}
+
+	return p, nil
+}
+
+func (e *extractor) mkdir(name string, mode fs.FileMode) error {
+	if err := e.entry(); err != nil {
+		return err
+	}
+	p, err := e.resolve(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, dirMode(mode))
+}
+
+func (e *extractor) writeFile(name string, r io.Reader, mode fs.FileMode) error {
+	if err := e.entry(); err != nil {
+		return err
+	}
+	p, err := e.resolve(name)
+	if err != nil {
+		return err
+	}
+	return e.writeFileAt(p, r, mode)
+}
+
+func (e *extractor) writeFileAt(p string, r io.Reader, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	// never write through a link left by a previous entry
+	if info, err := os.Lstat(p); err == nil && !info.Mode().IsRegular() {
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fileMode(mode))
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, &budgetReader{r: r, e: e})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// budgetReader charges every byte read against the extraction's MaxTotalSize
+type budgetReader struct {
+	r io.Reader
+	e *extractor
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if written := b.e.written.Add(int64(n)); b.e.opts.MaxTotalSize > 0 && written > b.e.opts.MaxTotalSize {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
+
+// reuse links or keeps the file matching size and crc32 from the reference tree, reporting whether it did
+func (e *extractor) reuse(p string, size uint64, crc uint32) bool {
+	if !e.opts.SkipUnchanged {
+		return false
+	}
+
+	reference := p
+	if e.opts.Reference != "" {
+		rel, err := filepath.Rel(e.dest, p)
+		if err != nil {
+			return false
+		}
+		reference = filepath.Join(e.opts.Reference, rel)
+	}
+
+	info, err := os.Lstat(reference)
+	if err != nil || !info.Mode().IsRegular() || uint64(info.Size()) != size {
+		return false
+	}
+	if sum, err := crc32File(reference); err != nil || sum != crc {
+		return false
+	}
+
+	if reference == p {
+		return true
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return false
+	}
+	return os.Link(reference, p) == nil
+}
+
+func crc32File(p string) (uint32, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, f); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+func (e *extractor) symlink(name string, target string) error {
+	if err := e.entry(); err != nil {
+		return err
+	}
+
+	switch e.opts.Symlinks {
+	case SymlinkSkip:
+		return nil
+	case SymlinkReject:
+		return fmt.Errorf("%w: %q -> %q", ErrIllegalLink, name, target)
+	}
+
+	p, err := e.resolve(name)
+	if err != nil {
+		return err
+	}
+	if !e.isContainedLink(p, target) {
+		return fmt.Errorf("%w: %q -> %q", ErrIllegalLink, name, target)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	os.Remove(p)
+	return os.Symlink(filepath.FromSlash(target), p)
+}
+
+// isContainedLink accepts relative, clean targets (only leading ".." components) landing inside dest
+func (e *extractor) isContainedLink(p string, target string) bool {
+	if target == "" || strings.Contains(target, `\`) || path.IsAbs(target) || filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+		return false
+	}
+	// a clean relative path can only hold ".." as leading components, so it never climbs back through another link
+	if path.Clean(target) != target {
+		return false
+	}
+
+	resolved := filepath.Join(filepath.Dir(p), filepath.FromSlash(target))
+	return isWithin(e.dest, resolved)
+}
+
+func (e *extractor) hardlink(name string, target string) error {
+	if err := e.entry(); err != nil {
+		return err
+	}
+	p, err := e.resolve(name)
+	if err != nil {
+		return err
+	}
+	src, err := e.resolve(target)
+	if err != nil {
+		return fmt.Errorf("%w: %q => %q", ErrIllegalLink, name, target)
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil || !info.Mode().IsRegular() {
+		return fmt.Errorf("%w: %q => %q", ErrIllegalLink, name, target)
+	}
+
+	// copy rather than link, so that later modifications of either file stay independent
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return e.writeFileAt(p, f, info.Mode())
+}
+
+func isWithin(root string, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func fileMode(mode fs.FileMode) fs.FileMode {
+	perm := mode.Perm()
+	if perm == 0 {
+		return 0644
+	}
+	return perm | 0600
+}
+
+func dirMode(mode fs.FileMode) fs.FileMode {
+	perm := mode.Perm()
+	if perm == 0 {
+		return 0755
+	}
+	return perm | 0700
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const sentinel = "untouched"
+
+// newFuzzRoot returns a folder holding dest and a sibling outside/ with a sentinel file, the target of escaping entries
+func newFuzzRoot(t *testing.T) (root string, dest string) {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "outside"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "outside", "sentinel"), []byte(sentinel), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return root, filepath.Join(root, "dest")
+}
+
+func fuzzOptions(workers uint8) Options {
+	opts := DefaultOptions
+	opts.MaxTotalSize = 1 << 20
+	opts.MaxEntries = 1000
+	opts.Workers = int(workers % 8)
+	return opts
+}
+
+// checkContained fails when anything was written outside of dest or a link inside dest resolves outside of it
+func checkContained(t *testing.T, root string, dest string) {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join(root, "outside", "sentinel"))
+	if err != nil || string(content) != sentinel {
+		t.Fatalf("sentinel outside of dest was modified: %q, %v", content, err)
+	}
+
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch p {
+		case root, filepath.Join(root, "outside"), filepath.Join(root, "outside", "sentinel"):
+			return nil
+		}
+		if !isWithin(dest, p) {
+			t.Errorf("%s was written outside of dest", p)
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+
+		target, err := os.Readlink(p)
+		if err != nil {
+			return err
+		}
+		if filepath.IsAbs(target) {
+			t.Errorf("%s links to the absolute path %s", p, target)
+			return nil
+		}
+		resolved, err := filepath.EvalSymlinks(p)
+		if err != nil {
+			// dangling links are harmless as long as their target would land inside dest
+			resolved = filepath.Join(filepath.Dir(p), target)
+		}
+		if !isWithin(dest, resolved) {
+			t.Errorf("%s links outside of dest to %s", p, resolved)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractLimits(t *testing.T) {
+	zipData := buildZip(t, zipEntry{"dir/", fs.ModeDir | 0755, ""}, zipEntry{"dir/a", 0644, "0123456789"}, zipEntry{"b", 0644, "0123456789"})
+	tarData := gzipBytes(t, buildTar(t, tarEntry{typeflag: tar.TypeDir, name: "dir/"}, tarEntry{typeflag: tar.TypeReg, name: "dir/a", body: "0123456789"}, tarEntry{typeflag: tar.TypeReg, name: "b", body: "0123456789"}))
+
+	extractors := map[string]func(dest string, opts Options) error{
+		"zip": func(dest string, opts Options) error {
+			r, err := zip.NewReader(bytes.NewReader(zipData), int64(len(zipData)))
+			if err != nil {
+				return err
+			}
+			return ExtractZip(r, dest, opts)
+		},
+		"zip with workers": func(dest string, opts Options) error {
+			r, err := zip.NewReader(bytes.NewReader(zipData), int64(len(zipData)))
+			if err != nil {
+				return err
+			}
+			opts.Workers = 4
+			return ExtractZip(r, dest, opts)
+		},
+		"tar.gz": func(dest string, opts Options) error {
+			return ExtractTarGZ(bytes.NewReader(tarData), dest, opts)
+		},
+	}
+
+	for _, tt := range []struct {
+		name         string
+		maxEntries   int
+		maxTotalSize int64
+		err          error
+	}{
+		{"unlimited", 0, 0, nil},
+		{"at the limits", 3, 20, nil},
+		{"too many entries", 2, 0, ErrTooManyEntries},
+		{"too large", 0, 19, ErrTooLarge},
+	} {
+		for format, extract := range extractors {
+			t.Run(tt.name+"/"+format, func(t *testing.T) {
+				opts := DefaultOptions
+				opts.MaxEntries, opts.MaxTotalSize = tt.maxEntries, tt.maxTotalSize
+				if err := extract(t.TempDir(), opts); !errors.Is(err, tt.err) {
+					t.Fatalf("extraction = %v, want %v", err, tt.err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package archive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Stage runs extract against a sibling temporary folder, which replaces dest only once extract succeeded.
+// The previous tree at dest stays untouched until the swap
+func Stage(dest string, extract func(tmp string) error) error {
+	return StageKeep(dest, "", extract)
+}
+
+// StageKeep is Stage, but moves the previous tree at dest to keep instead of removing it
+func StageKeep(dest string, keep string, extract func(tmp string) error) error {
+	parent, base := filepath.Dir(dest), filepath.Base(dest)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+	cleanupStaging(parent, base)
+
+	tmp, err := os.MkdirTemp(parent, "."+base+".staging-*")
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+
+	if err := extract(tmp); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+
+	return Swap(tmp, dest, keep)
+}
+
+// Swap replaces dest with src, then moves the previous tree at dest to keep, or removes it when keep is empty.
+// Swapping a folder with its keep exchanges them
+func Swap(src string, dest string, keep string) error {
+	old := ""
+	if _, err := os.Lstat(dest); err == nil {
+		old, err = reserveSibling(dest, "old")
+		if err != nil {
+			os.RemoveAll(src)
+			return err
+		}
+		if err := os.Rename(dest, old); err != nil {
+			os.RemoveAll(src)
+			return fmt.Errorf("failed to move %s out of the way: %w", dest, err)
+		}
+	}
+
+	if err := os.Rename(src, dest); err != nil {
+		if old != "" {
+			os.Rename(old, dest)
+		}
+		os.RemoveAll(src)
+		return fmt.Errorf("failed to swap in %s: %w", dest, err)
+	}
+
+	if old == "" {
+		return nil
+	}
+	if keep != "" {
+		// src was moved to dest, which frees keep when swapping with it
+		if err := os.RemoveAll(keep); err != nil {
+			return err
+		}
+		return os.Rename(old, keep)
+	}
+	// RemoveAll removes links themselves, never what they point to
+	return os.RemoveAll(old)
+}
+
+func reserveSibling(p string, kind string) (string, error) {
+	reserved, err := os.MkdirTemp(filepath.Dir(p), "."+filepath.Base(p)+"."+kind+"-*")
+	if err != nil {
+		return "", err
+	}
+	return reserved, os.Remove(reserved)
+}
+
+// cleanupStaging removes leftovers of interrupted stagings of base
+func cleanupStaging(parent string, base string) {
+	for _, kind := range []string{"staging", "old"} {
+		leftovers, _ := filepath.Glob(filepath.Join(parent, "."+base+"."+kind+"-*"))
+		for _, leftover := range leftovers {
+			os.RemoveAll(leftover)
+		}
+	}
+}
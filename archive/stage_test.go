@@ -0,0 +1,173 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package archive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writeTree(t *testing.T, dir string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTree returns the content of the file written by writeTree, or "" when there's none
+func readTree(t *testing.T, dir string) string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(dir, "file"))
+	if err != nil {
+		return ""
+	}
+	return string(content)
+}
+
+// checkSiblings fails unless the parent folder holds exactly names, i.e. no staging or old folder was left over
+func checkSiblings(t *testing.T, parent string, names ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Name())
+	}
+	slices.Sort(names)
+	if !slices.Equal(got, names) {
+		t.Fatalf("%s holds %q, want %q", parent, got, names)
+	}
+}
+
+func TestStage(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		previous string
+		keep     bool
+	}{
+		{"new", "", false},
+		{"replace", "old", false},
+		{"replace and keep", "old", true},
+		{"new with keep", "", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dest, keep := filepath.Join(parent, "dest"), ""
+			if tt.keep {
+				keep = filepath.Join(parent, "keep")
+				writeTree(t, keep, "kept before")
+			}
+			if tt.previous != "" {
+				writeTree(t, dest, tt.previous)
+			}
+
+			err := StageKeep(dest, keep, func(tmp string) error {
+				if filepath.Dir(tmp) != parent {
+					t.Errorf("staging in %s, outside of %s", tmp, parent)
+				}
+				writeTree(t, tmp, "new")
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readTree(t, dest); got != "new" {
+				t.Fatalf("dest holds %q, want new", got)
+			}
+
+			siblings := []string{"dest"}
+			if tt.keep {
+				siblings = append(siblings, "keep")
+				want := "kept before"
+				if tt.previous != "" {
+					want = tt.previous
+				}
+				if got := readTree(t, keep); got != want {
+					t.Fatalf("keep holds %q, want %q", got, want)
+				}
+			}
+			checkSiblings(t, parent, siblings...)
+		})
+	}
+}
+
+func TestStageFailureKeepsDest(t *testing.T) {
+	parent := t.TempDir()
+	dest := filepath.Join(parent, "dest")
+	writeTree(t, dest, "old")
+
+	errExtract := errors.New("extraction failed")
+	err := Stage(dest, func(tmp string) error {
+		writeTree(t, tmp, "partial")
+		return errExtract
+	})
+	if !errors.Is(err, errExtract) {
+		t.Fatalf("Stage() = %v, want %v", err, errExtract)
+	}
+	if got := readTree(t, dest); got != "old" {
+		t.Fatalf("dest holds %q after a failed stage, want old", got)
+	}
+	checkSiblings(t, parent, "dest")
+}
+
+func TestStageRemovesLeftovers(t *testing.T) {
+	parent := t.TempDir()
+	dest := filepath.Join(parent, "dest")
+	writeTree(t, dest, "old")
+	for _, leftover := range []string{".dest.staging-1", ".dest.old-2"} {
+		writeTree(t, filepath.Join(parent, leftover), "interrupted")
+	}
+	// leftovers of other folders aren't this stage's business
+	writeTree(t, filepath.Join(parent, ".other.staging-1"), "other")
+
+	if err := Stage(dest, func(tmp string) error {
+		writeTree(t, tmp, "new")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	checkSiblings(t, parent, "dest", ".other.staging-1")
+}
+
+func TestSwapKeepsOldTreeWhenRenameFails(t *testing.T) {
+	parent := t.TempDir()
+	dest := filepath.Join(parent, "dest")
+	writeTree(t, dest, "old")
+
+	// renaming a missing src fails after dest was moved out of the way
+	if err := Swap(filepath.Join(parent, "missing"), dest, ""); err == nil {
+		t.Fatal("Swap() of a missing folder succeeded")
+	}
+	if got := readTree(t, dest); got != "old" {
+		t.Fatalf("dest holds %q after a failed swap, want old", got)
+	}
+	checkSiblings(t, parent, "dest")
+}
+
+func TestSwapExchangesWithKeep(t *testing.T) {
+	parent := t.TempDir()
+	dest, keep := filepath.Join(parent, "dest"), filepath.Join(parent, "keep")
+	writeTree(t, dest, "current")
+	writeTree(t, keep, "previous")
+
+	for _, want := range []string{"previous", "current"} {
+		if err := Swap(keep, dest, keep); err != nil {
+			t.Fatal(err)
+		}
+		if got := readTree(t, dest); got != want {
+			t.Fatalf("dest holds %q, want %q", got, want)
+		}
+		checkSiblings(t, parent, "dest", "keep")
+	}
+}
@@ -8,12 +8,15 @@ package archive
 import (
 	"archive/tar"
 	"compress/gzip"
+	"fmt"
 	"io"
-	"os"
-	"path/filepath"
 )
 
 func UnTarGZ(r io.Reader, dest string) error {
+	return ExtractTarGZ(r, dest, DefaultOptions)
+}
+
+func ExtractTarGZ(r io.Reader, dest string, opts Options) error {
 	gzipReader, err := gzip.NewReader(r)
 	if err != nil {
 		return err
@@ -22,7 +25,11 @@ func UnTarGZ(r io.Reader, dest string) error {
 
 	tarReader := tar.NewReader(gzipReader)
 
-	os.MkdirAll(dest, 0755)
+	e, err := newExtractor(dest, opts)
+	if err != nil {
+		return err
+	}
+
 	for {
 		header, err := tarReader.Next()
 		if err == io.EOF {
@@ -32,22 +39,24 @@ func UnTarGZ(r io.Reader, dest string) error {
 			return err
 		}
 
-		tarEntryDest := filepath.Join(dest, header.Name)
+		mode := header.FileInfo().Mode()
 
 		switch header.Typeflag {
 		case tar.TypeDir:
-			if err := os.Mkdir(tarEntryDest, 0755); err != nil {
-				return err
-			}
-		case tar.TypeReg:
-			tarEntryFile, err := os.Create(tarEntryDest)
-			if err != nil {
-				return err
-			}
-			if _, err := io.Copy(tarEntryFile, tarReader); err != nil {
-				return err
-			}
-			tarEntryFile.Close()
+			err = e.mkdir(header.Name, mode)
+		case tar.TypeReg, tar.TypeRegA:
+			err = e.writeFile(header.Name, tarReader, mode)
+		case tar.TypeSymlink:
+			err = e.symlink(header.Name, header.Linkname)
+		case tar.TypeLink:
+			err = e.hardlink(header.Name, header.Linkname)
+		case tar.TypeXGlobalHeader, tar.TypeXHeader, tar.TypeGNULongName, tar.TypeGNULongLink:
+			continue
+		default:
+			err = fmt.Errorf("%w: %q has type %q", ErrUnsupportedEntry, header.Name, header.Typeflag)
+		}
+		if err != nil {
+			return err
 		}
 	}
 
@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+type tarEntry struct {
+	typeflag byte
+	name     string
+	linkname string
+	body     string
+}
+
+func buildTar(t testing.TB, entries ...tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &tar.Header{Typeflag: entry.typeflag, Name: entry.name, Linkname: entry.linkname, Mode: 0644, Size: int64(len(entry.body))}
+		if entry.typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			if _, err := w.Write([]byte(entry.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipBytes(t testing.TB, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// FuzzExtractTarGZ fuzzes the tar stream, gzipping it is left to the harness so that mutations aren't wasted on checksums
+func FuzzExtractTarGZ(f *testing.F) {
+	for _, entries := range [][]tarEntry{
+		{{tar.TypeDir, "a/", "", ""}, {tar.TypeReg, "a/b.txt", "", "b"}, {tar.TypeSymlink, "a/c", "b.txt", ""}, {tar.TypeLink, "d", "a/b.txt", ""}},
+		{{tar.TypeReg, "../outside/sentinel", "", "pwned"}},
+		{{tar.TypeReg, "a/../../outside/sentinel", "", "pwned"}},
+		{{tar.TypeReg, "/tmp/pwned", "", "pwned"}},
+		{{tar.TypeReg, `..\outside\sentinel`, "", "pwned"}},
+		{{tar.TypeSymlink, "link", "../outside", ""}, {tar.TypeReg, "link/sentinel", "", "pwned"}},
+		{{tar.TypeSymlink, "link", "/tmp", ""}, {tar.TypeReg, "link/pwned", "", "pwned"}},
+		{{tar.TypeSymlink, "self", ".", ""}, {tar.TypeSymlink, "self/up", "..", ""}, {tar.TypeReg, "self/up/outside/sentinel", "", "pwned"}},
+		{{tar.TypeSymlink, "a/link", "../../outside/sentinel", ""}, {tar.TypeReg, "a/link", "", "pwned"}},
+		{{tar.TypeLink, "hard", "../outside/sentinel", ""}},
+		{{tar.TypeLink, "hard", "/etc/passwd", ""}},
+		{{tar.TypeSymlink, "link", "../outside/sentinel", ""}, {tar.TypeLink, "hard", "link", ""}},
+	} {
+		f.Add(buildTar(f, entries...), uint8(0))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, workers uint8) {
+		root, dest := newFuzzRoot(t)
+		ExtractTarGZ(bytes.NewReader(gzipBytes(t, data)), dest, fuzzOptions(workers))
+		checkContained(t, root, dest)
+	})
+}
@@ -9,62 +9,150 @@ import (
 	"archive/zip"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
-	"strings"
+	"io/fs"
+	"sync"
 )
 
-// pasta from https://stackoverflow.com/a/24792688
 func UnZip(r *zip.Reader, dest string) error {
-	os.MkdirAll(dest, 0755)
+	return ExtractZip(r, dest, DefaultOptions)
+}
 
-	// Closure to address file descriptors issue with all the deferred .Close() methods
-	extractAndWriteFile := func(f *zip.File) error {
-		rc, err := f.Open()
-		if err != nil {
-			return err
-		}
-		defer func() {
-			if err := rc.Close(); err != nil {
-				panic(err)
-			}
-		}()
+// ExtractZip extracts r into dest, using up to opts.Workers concurrent workers.
+// r must support concurrent reads when opts.Workers > 1
+func ExtractZip(r *zip.Reader, dest string, opts Options) error {
+	if opts.MaxEntries > 0 && len(r.File) > opts.MaxEntries {
+		return ErrTooManyEntries
+	}
 
-		path := filepath.Join(dest, f.Name)
+	e, err := newExtractor(dest, opts)
+	if err != nil {
+		return err
+	}
+	e.total = len(r.File)
 
-		// Check for ZipSlip (Directory traversal)
-		if !strings.HasPrefix(path, filepath.Clean(dest)+string(os.PathSeparator)) {
-			return fmt.Errorf("illegal file path: %s", path)
+	if opts.Workers <= 1 {
+		for _, f := range r.File {
+			if err := extractZipEntry(e, f); err != nil {
+				return err
+			}
 		}
+		return nil
+	}
 
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(path, f.Mode())
-		} else {
-			os.MkdirAll(filepath.Dir(path), f.Mode())
-			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-			if err != nil {
+	// folders first so that workers never race on them, links last so that no worker writes through one
+	var files, links []*zip.File
+	for _, f := range r.File {
+		switch mode := f.Mode(); {
+		case mode.IsDir():
+			if err := extractZipEntry(e, f); err != nil {
 				return err
 			}
-			defer func() {
-				if err := f.Close(); err != nil {
-					panic(err)
-				}
-			}()
+		case mode&fs.ModeSymlink != 0:
+			links = append(links, f)
+		default:
+			files = append(files, f)
+		}
+	}
 
-			_, err = io.Copy(f, rc)
-			if err != nil {
-				return err
+	if err := extractZipEntries(e, files, opts.Workers); err != nil {
+		return err
+	}
+
+	for _, f := range links {
+		if err := extractZipEntry(e, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func extractZipEntries(e *extractor, files []*zip.File, workers int) error {
+	jobs := make(chan *zip.File)
+	stop := make(chan struct{})
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			close(stop)
+		})
+	}
+
+	for range min(workers, len(files)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				if err := extractZipEntry(e, f); err != nil {
+					fail(err)
+				}
 			}
+		}()
+	}
+
+feed:
+	for _, f := range files {
+		select {
+		case jobs <- f:
+		case <-stop:
+			break feed
 		}
-		return nil
 	}
+	close(jobs)
+	wg.Wait()
 
-	for _, f := range r.File {
-		err := extractAndWriteFile(f)
+	return firstErr
+}
+
+func extractZipEntry(e *extractor, f *zip.File) error {
+	defer e.progress()
+
+	mode := f.Mode()
+
+	switch {
+	case mode.IsDir():
+		return e.mkdir(f.Name, mode)
+	case mode&fs.ModeSymlink != 0:
+		target, err := readZipEntry(f, 4096)
 		if err != nil {
 			return err
 		}
+		return e.symlink(f.Name, target)
+	case mode.IsRegular():
+		if err := e.entry(); err != nil {
+			return err
+		}
+		p, err := e.resolve(f.Name)
+		if err != nil {
+			return err
+		}
+		if e.reuse(p, f.UncompressedSize64, f.CRC32) {
+			return nil
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return e.writeFileAt(p, rc, mode)
+	default:
+		return fmt.Errorf("%w: %q has mode %s", ErrUnsupportedEntry, f.Name, mode)
+	}
+}
+
+func readZipEntry(f *zip.File, limit int64) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
 	}
+	defer rc.Close()
 
-	return nil
+	content, err := io.ReadAll(io.LimitReader(rc, limit))
+	return string(content), err
 }
@@ -0,0 +1,248 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type zipEntry struct {
+	name string
+	mode fs.FileMode
+	body string
+}
+
+func buildZip(t testing.TB, entries ...zipEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		header.SetMode(entry.mode)
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(entry.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func FuzzExtractZip(f *testing.F) {
+	const link = fs.ModeSymlink | 0777
+	for _, entries := range [][]zipEntry{
+		{{"a/", fs.ModeDir | 0755, ""}, {"a/b.txt", 0644, "b"}, {"a/c", link, "b.txt"}},
+		{{"../outside/sentinel", 0644, "pwned"}},
+		{{"a/../../outside/sentinel", 0644, "pwned"}},
+		{{"/tmp/pwned", 0644, "pwned"}},
+		{{`..\outside\sentinel`, 0644, "pwned"}},
+		{{"link", link, "../outside"}, {"link/sentinel", 0644, "pwned"}},
+		{{"link", link, "/tmp"}, {"link/pwned", 0644, "pwned"}},
+		{{"self", link, "."}, {"self/up", link, ".."}, {"self/up/outside/sentinel", 0644, "pwned"}},
+		{{"a/link", link, "../../outside/sentinel"}, {"a/link", 0644, "pwned"}},
+		{{"a/link", link, "../../outside/sentinel"}, {"a/b", 0644, "b"}, {"a/link", 0644, "pwned"}},
+	} {
+		data := buildZip(f, entries...)
+		f.Add(data, uint8(0))
+		f.Add(data, uint8(4))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, workers uint8) {
+		r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return
+		}
+		root, dest := newFuzzRoot(t)
+		ExtractZip(r, dest, fuzzOptions(workers))
+		checkContained(t, root, dest)
+	})
+}
+
+// xpui.spa holds about 2000 entries for 30MB once extracted, mostly minified js and css
+const (
+	benchmarkEntries = 2000
+	benchmarkSize    = 30 << 20
+)
+
+var benchmarkZip = sync.OnceValue(func() []byte {
+	words := strings.Fields("function return const let var this null undefined true false if else for while new class extends import export default async await => ( ) { } [ ] ; , . = + - * / && || ! ? :")
+	rng := rand.New(rand.NewSource(1))
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	var content strings.Builder
+	for i := range benchmarkEntries {
+		// sizes spread around the mean, as a few bundles dwarf the many small assets
+		size := rng.Intn(2 * benchmarkSize / benchmarkEntries)
+		content.Reset()
+		for content.Len() < size {
+			content.WriteString(words[rng.Intn(len(words))])
+			if rng.Intn(4) == 0 {
+				fmt.Fprintf(&content, "%x", rng.Int31())
+			}
+		}
+
+		f, err := w.CreateHeader(&zip.FileHeader{Name: fmt.Sprintf("xpui/%d/%d.js", i%40, i), Method: zip.Deflate})
+		if err != nil {
+			panic(err)
+		}
+		if _, err := f.Write([]byte(content.String())); err != nil {
+			panic(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+})
+
+// BenchmarkExtractZip extracts like apply does, to a fresh folder next to the previously extracted tree
+func BenchmarkExtractZip(b *testing.B) {
+	data := benchmarkZip()
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var size int64
+	for _, f := range r.File {
+		size += int64(f.UncompressedSize64)
+	}
+
+	// a single cpu would only run workers=1 twice
+	for _, workers := range slices.Compact([]int{1, runtime.NumCPU()}) {
+		for _, skipUnchanged := range []bool{false, true} {
+			b.Run(fmt.Sprintf("workers=%d/skip-unchanged=%t", workers, skipUnchanged), func(b *testing.B) {
+				root := b.TempDir()
+				reference := filepath.Join(root, "reference")
+				if err := ExtractZip(r, reference, DefaultOptions); err != nil {
+					b.Fatal(err)
+				}
+
+				opts := DefaultOptions
+				opts.Workers = workers
+				opts.SkipUnchanged = skipUnchanged
+				opts.Reference = reference
+
+				b.SetBytes(size)
+				b.ResetTimer()
+				for i := range b.N {
+					dest := filepath.Join(root, fmt.Sprint(i))
+					if err := ExtractZip(r, dest, opts); err != nil {
+						b.Fatal(err)
+					}
+
+					b.StopTimer()
+					if err := os.RemoveAll(dest); err != nil {
+						b.Fatal(err)
+					}
+					b.StartTimer()
+				}
+			})
+		}
+	}
+}
+
+func TestExtractZipReuse(t *testing.T) {
+	files := []zipEntry{
+		{"same", 0644, "unchanged"},
+		{"sub/same", 0644, "unchanged too"},
+		{"changed", 0644, "new content"},
+		{"resized", 0644, "new"},
+	}
+	data := buildZip(t, files...)
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// same size, different crc32
+	previous := map[string]string{"same": "unchanged", "sub/same": "unchanged too", "changed": "old content", "resized": "older"}
+	writePrevious := func(dir string) {
+		for name, content := range previous {
+			p := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	stat := func(p string) os.FileInfo {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+	check := func(dest string, reference string) {
+		t.Helper()
+		for _, f := range files {
+			p := filepath.Join(dest, filepath.FromSlash(f.name))
+			content, err := os.ReadFile(p)
+			if err != nil || string(content) != f.body {
+				t.Fatalf("%s holds %q, %v, want %q", f.name, content, err, f.body)
+			}
+			reused := os.SameFile(stat(p), stat(filepath.Join(reference, filepath.FromSlash(f.name))))
+			if want := previous[f.name] == f.body; reused != want {
+				t.Errorf("%s reused: %t, want %t", f.name, reused, want)
+			}
+		}
+	}
+
+	t.Run("reference", func(t *testing.T) {
+		reference, dest := t.TempDir(), t.TempDir()
+		writePrevious(reference)
+		opts := DefaultOptions
+		opts.SkipUnchanged, opts.Reference = true, reference
+		if err := ExtractZip(r, dest, opts); err != nil {
+			t.Fatal(err)
+		}
+		check(dest, reference)
+		// the reference stays as it was
+		if content, _ := os.ReadFile(filepath.Join(reference, "changed")); string(content) != "old content" {
+			t.Fatalf("reference was modified: %q", content)
+		}
+	})
+
+	t.Run("dest", func(t *testing.T) {
+		dest := t.TempDir()
+		writePrevious(dest)
+		before := map[string]os.FileInfo{}
+		for name := range previous {
+			before[name] = stat(filepath.Join(dest, filepath.FromSlash(name)))
+		}
+		opts := DefaultOptions
+		opts.SkipUnchanged = true
+		if err := ExtractZip(r, dest, opts); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"same", "sub/same"} {
+			if !os.SameFile(before[name], stat(filepath.Join(dest, filepath.FromSlash(name)))) {
+				t.Errorf("%s was rewritten", name)
+			}
+		}
+		if content, _ := os.ReadFile(filepath.Join(dest, "changed")); string(content) != "new content" {
+			t.Errorf("changed holds %q", content)
+		}
+	})
+}
@@ -0,0 +1,256 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const ManifestFile = "manifest.json"
+
+var ErrNotFound = errors.New("snapshot not found")
+
+// Manifest describes a snapshot of the stock spa files of a Spotify installation
+type Manifest struct {
+	ID             string    `json:"id"`
+	SpotifyVersion string    `json:"spotifyVersion"`
+	CreatedAt      time.Time `json:"createdAt"`
+	// Files maps the name of every spa, without its extension, to its sha256
+	Files map[string]string `json:"files"`
+}
+
+// Store keeps every snapshot in its own folder, holding the manifest next to the spa files
+type Store struct {
+	Dir string
+}
+
+func (s Store) path(id string, parts ...string) string {
+	return filepath.Join(append([]string{s.Dir, id}, parts...)...)
+}
+
+// Create snapshots spas, which maps spa names to their path.
+// The newest snapshot is returned instead when it already holds the same files
+func (s Store) Create(spotifyVersion string, spas map[string]string) (*Manifest, error) {
+	files := map[string]string{}
+	for name, spa := range spas {
+		hash, err := hashFile(spa)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = hash
+	}
+
+	snapshots, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) > 0 {
+		latest := snapshots[0]
+		if latest.SpotifyVersion == spotifyVersion && maps.Equal(latest.Files, files) {
+			return &latest, nil
+		}
+	}
+
+	now := time.Now().UTC()
+	m := &Manifest{
+		ID:             fmt.Sprintf("%s-%d", now.Format("20060102T150405Z"), now.Nanosecond()/1e6),
+		SpotifyVersion: spotifyVersion,
+		CreatedAt:      now,
+		Files:          files,
+	}
+
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp(s.Dir, ".staging-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	for name, spa := range spas {
+		dest := filepath.Join(tmp, name+".spa")
+		hash, err := copyFile(spa, dest)
+		if err != nil {
+			return nil, err
+		}
+		// the spa changed since it was hashed, most likely because Spotify is updating
+		if hash != files[name] {
+			return nil, fmt.Errorf("%s changed while taking the snapshot", spa)
+		}
+	}
+
+	content, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, ManifestFile), content, 0644); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp, s.path(m.ID)); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// List returns every snapshot, newest first
+func (s Store) List() ([]Manifest, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var manifests []Manifest
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		m, err := s.Get(entry.Name())
+		if err != nil {
+			continue
+		}
+		manifests = append(manifests, *m)
+	}
+
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].CreatedAt.After(manifests[j].CreatedAt)
+	})
+	return manifests, nil
+}
+
+func (s Store) Get(id string) (*Manifest, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	raw, err := os.ReadFile(s.path(id, ManifestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest of snapshot %s: %w", id, err)
+	}
+	m.ID = id
+	return &m, nil
+}
+
+// Match returns the newest snapshot taken from spotifyVersion
+func (s Store) Match(spotifyVersion string) (*Manifest, error) {
+	if spotifyVersion == "" {
+		return nil, fmt.Errorf("%w: unknown Spotify version", ErrNotFound)
+	}
+
+	snapshots, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range snapshots {
+		if m.SpotifyVersion == spotifyVersion {
+			return &m, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no snapshot of Spotify %s", ErrNotFound, spotifyVersion)
+}
+
+// RestoreFile writes the spa called name of snapshot m to dest, verifying its checksum
+func (s Store) RestoreFile(m *Manifest, name string, dest string) error {
+	expected, ok := m.Files[name]
+	if !ok {
+		return fmt.Errorf("snapshot %s doesn't hold %s.spa", m.ID, name)
+	}
+
+	tmp := dest + ".restoring"
+	hash, err := copyFile(s.path(m.ID, name+".spa"), tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if hash != expected {
+		os.Remove(tmp)
+		return fmt.Errorf("%s.spa of snapshot %s is corrupted", name, m.ID)
+	}
+	return os.Rename(tmp, dest)
+}
+
+func (s Store) Remove(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	return os.RemoveAll(s.path(id))
+}
+
+// Prune removes all but the keep newest snapshots, returning the removed ones
+func (s Store) Prune(keep int) ([]Manifest, error) {
+	snapshots, err := s.List()
+	if err != nil || len(snapshots) <= keep {
+		return nil, err
+	}
+
+	removed := snapshots[max(keep, 0):]
+	for _, m := range removed {
+		if err := os.RemoveAll(s.path(m.ID)); err != nil {
+			return nil, err
+		}
+	}
+	return removed, nil
+}
+
+func copyFile(src string, dest string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, h), in); err != nil {
+		out.Close()
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,231 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package backup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeSpas writes a spa file for every name to dir, returning the map Create expects
+func writeSpas(t *testing.T, dir string, contents map[string]string) map[string]string {
+	t.Helper()
+	spas := map[string]string{}
+	for name, content := range contents {
+		p := filepath.Join(dir, name+".spa")
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		spas[name] = p
+	}
+	return spas
+}
+
+// create snapshots contents, spacing snapshots out so that their order is well defined
+func create(t *testing.T, s Store, spotifyVersion string, contents map[string]string) *Manifest {
+	t.Helper()
+	m, err := s.Create(spotifyVersion, writeSpas(t, t.TempDir(), contents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	return m
+}
+
+func TestCreate(t *testing.T) {
+	s := Store{Dir: t.TempDir()}
+
+	first := create(t, s, "1.2.3", map[string]string{"xpui": "a", "login": "b"})
+	if len(first.Files) != 2 {
+		t.Fatalf("Files = %v, want xpui and login", first.Files)
+	}
+	for name := range first.Files {
+		if _, err := os.Stat(s.path(first.ID, name+".spa")); err != nil {
+			t.Errorf("%s.spa wasn't copied: %v", name, err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name           string
+		spotifyVersion string
+		contents       map[string]string
+		reused         bool
+	}{
+		{"same files", "1.2.3", map[string]string{"xpui": "a", "login": "b"}, true},
+		{"changed file", "1.2.3", map[string]string{"xpui": "c", "login": "b"}, false},
+		{"other version", "1.2.4", map[string]string{"xpui": "c", "login": "b"}, false},
+		{"fewer files", "1.2.4", map[string]string{"xpui": "c"}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			latest, err := s.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := create(t, s, tt.spotifyVersion, tt.contents)
+			if reused := m.ID == latest[0].ID; reused != tt.reused {
+				t.Fatalf("reused the newest snapshot = %t, want %t", reused, tt.reused)
+			}
+		})
+	}
+
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name()[0] == '.' {
+			t.Errorf("staging folder %s left behind", entry.Name())
+		}
+	}
+}
+
+func TestCreateMissingSpa(t *testing.T) {
+	s := Store{Dir: t.TempDir()}
+	if _, err := s.Create("1.2.3", map[string]string{"xpui": filepath.Join(t.TempDir(), "missing.spa")}); err == nil {
+		t.Fatal("Create() of a missing spa succeeded")
+	}
+	if snapshots, _ := s.List(); len(snapshots) != 0 {
+		t.Fatalf("List() = %v, want no snapshot", snapshots)
+	}
+}
+
+func TestListAndMatch(t *testing.T) {
+	s := Store{Dir: t.TempDir()}
+	if snapshots, err := s.List(); err != nil || len(snapshots) != 0 {
+		t.Fatalf("List() of a missing store = %v, %v", snapshots, err)
+	}
+
+	old := create(t, s, "1.0.0", map[string]string{"xpui": "a"})
+	other := create(t, s, "2.0.0", map[string]string{"xpui": "b"})
+	newer := create(t, s, "1.0.0", map[string]string{"xpui": "c"})
+
+	// neither staging folders nor folders without a manifest are snapshots
+	os.MkdirAll(filepath.Join(s.Dir, ".staging-1"), 0755)
+	os.MkdirAll(filepath.Join(s.Dir, "broken"), 0755)
+
+	snapshots, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, m := range snapshots {
+		ids = append(ids, m.ID)
+	}
+	if want := []string{newer.ID, other.ID, old.ID}; !slices.Equal(ids, want) {
+		t.Fatalf("List() = %v, want newest first %v", ids, want)
+	}
+
+	for _, tt := range []struct {
+		spotifyVersion string
+		want           string
+	}{
+		{"1.0.0", newer.ID},
+		{"2.0.0", other.ID},
+		{"3.0.0", ""},
+		{"", ""},
+	} {
+		m, err := s.Match(tt.spotifyVersion)
+		switch {
+		case tt.want == "" && !errors.Is(err, ErrNotFound):
+			t.Errorf("Match(%q) = %v, want ErrNotFound", tt.spotifyVersion, err)
+		case tt.want != "" && (err != nil || m.ID != tt.want):
+			t.Errorf("Match(%q) = %v, %v, want %s", tt.spotifyVersion, m, err, tt.want)
+		}
+	}
+}
+
+func TestGetRejectsPaths(t *testing.T) {
+	s := Store{Dir: t.TempDir()}
+	for _, id := range []string{"", ".", "..", "../x", "a/b", ".staging-1"} {
+		if _, err := s.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) = %v, want ErrNotFound", id, err)
+		}
+	}
+}
+
+func TestRestoreFile(t *testing.T) {
+	s := Store{Dir: t.TempDir()}
+	m := create(t, s, "1.0.0", map[string]string{"xpui": "stock"})
+	dest := filepath.Join(t.TempDir(), "xpui.spa")
+
+	for _, tt := range []struct {
+		name    string
+		spa     string
+		corrupt bool
+		wantErr bool
+	}{
+		{"stock", "xpui", false, false},
+		{"missing from snapshot", "login", false, true},
+		{"corrupted", "xpui", true, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(dest, []byte("patched"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.corrupt {
+				if err := os.WriteFile(s.path(m.ID, "xpui.spa"), []byte("corrupted"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := s.RestoreFile(m, tt.spa, dest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RestoreFile() = %v, want error %t", err, tt.wantErr)
+			}
+
+			want := "stock"
+			if tt.wantErr {
+				want = "patched"
+			}
+			if content, _ := os.ReadFile(dest); string(content) != want {
+				t.Errorf("dest = %q, want %q", content, want)
+			}
+			if _, err := os.Stat(dest + ".restoring"); !os.IsNotExist(err) {
+				t.Errorf("temporary file left behind: %v", err)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	for _, tt := range []struct {
+		keep    int
+		removed int
+	}{
+		{5, 0},
+		{3, 0},
+		{2, 1},
+		{0, 3},
+		{-1, 3},
+	} {
+		s := Store{Dir: t.TempDir()}
+		var ids []string
+		for _, content := range []string{"a", "b", "c"} {
+			ids = append(ids, create(t, s, "1.0.0", map[string]string{"xpui": content}).ID)
+		}
+
+		removed, err := s.Prune(tt.keep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(removed) != tt.removed {
+			t.Errorf("Prune(%d) removed %d snapshots, want %d", tt.keep, len(removed), tt.removed)
+		}
+		// the oldest snapshots go first
+		for i, m := range removed {
+			if want := ids[len(removed)-1-i]; m.ID != want {
+				t.Errorf("Prune(%d) removed %s, want %s", tt.keep, m.ID, want)
+			}
+		}
+		if left, _ := s.List(); len(left) != 3-tt.removed {
+			t.Errorf("Prune(%d) left %d snapshots, want %d", tt.keep, len(left), 3-tt.removed)
+		}
+	}
+}
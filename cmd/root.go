@@ -14,6 +14,7 @@ import (
 	"github.com/Delusoire/bespoke-cli/v3/cmd/spicetify"
 	"github.com/Delusoire/bespoke-cli/v3/cmd/spotify"
 	"github.com/Delusoire/bespoke-cli/v3/cmd/vars"
+	"github.com/Delusoire/bespoke-cli/v3/network"
 	"github.com/Delusoire/bespoke-cli/v3/paths"
 
 	"github.com/spf13/cobra"
@@ -88,6 +89,24 @@ func initConfig() {
 		vars.SpotifyExecPath = viper.GetString("spotify-exec-path")
 		vars.SpotifyConfigPath = viper.GetString("spotify-config-path")
 	}
+
+	if spas, err := vars.LoadSpas(viper.GetViper()); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to load spas:", err)
+	} else {
+		vars.Spas = spas
+	}
+
+	if err := configureNetwork(); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to configure network:", err)
+	}
+}
+
+func configureNetwork() error {
+	config, err := network.LoadConfig(viper.GetViper())
+	if err != nil {
+		return err
+	}
+	return network.Configure(config)
 }
 
 func getInvokedExecutableName() string {
@@ -10,21 +10,39 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
+	"runtime"
 
 	"github.com/Delusoire/bespoke-cli/v3/archive"
 	"github.com/Delusoire/bespoke-cli/v3/cmd/vars"
 	"github.com/Delusoire/bespoke-cli/v3/link"
+	"github.com/Delusoire/bespoke-cli/v3/patch"
 	"github.com/Delusoire/bespoke-cli/v3/paths"
 	"github.com/charmbracelet/log"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	applyDryRun bool
+	applyJson   bool
+	applyForce  bool
+)
+
 var applyCmd = &cobra.Command{
 	Use:   "apply",
 	Short: "Apply spicetify patches on Spotify",
 	Run: func(cmd *cobra.Command, args []string) {
+		if applyDryRun {
+			plan, err := planApply()
+			if err != nil {
+				rootLogger.Fatal(err)
+			}
+			if err := printPlan(os.Stdout, plan, applyJson); err != nil {
+				rootLogger.Fatal(err)
+			}
+			return
+		}
+
 		if err := execApply(rootLogger); err != nil {
 			rootLogger.Fatal(err)
 		}
@@ -32,6 +50,12 @@ var applyCmd = &cobra.Command{
 	},
 }
 
+func init() {
+	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "print the patch plan without touching the Spotify installation")
+	applyCmd.Flags().BoolVar(&applyJson, "json", false, "print the patch plan as JSON (with --dry-run)")
+	applyCmd.Flags().BoolVar(&applyForce, "force", false, "apply hooks and mixins which don't support the installed Spotify version")
+}
+
 func getApps() (src string, dest string) {
 	src = paths.GetSpotifyAppsPath(vars.SpotifyDataPath)
 	if vars.Mirror {
@@ -42,85 +66,183 @@ func getApps() (src string, dest string) {
 	return src, dest
 }
 
-func extractSpa(spa string, destFolder string, logger *log.Logger) error {
-	basename := filepath.Base(spa)
-	extractDest := filepath.Join(destFolder, strings.TrimSuffix(basename, ".spa"))
+func extractSpa(spa string, extractDest string, logger *log.Logger) error {
 	logger.Infof("Extracting %s -> %s", spa, extractDest)
 
-	unzipSpa := func(spa, extractDest string) error {
-		r, err := zip.OpenReader(spa)
-		if err != nil {
-			return err
+	r, err := zip.OpenReader(spa)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	opts := archive.DefaultOptions
+	opts.Workers = runtime.NumCPU()
+	opts.SkipUnchanged = true
+	opts.Reference = extractDest
+	opts.Progress = func(done, total int) {
+		if done == total || done%500 == 0 {
+			logger.Debugf("Extracted %d/%d entries", done, total)
 		}
-		defer r.Close()
+	}
+
+	return archive.Stage(extractDest, func(tmp string) error {
+		return archive.ExtractZip(&r.Reader, tmp, opts)
+	})
+}
 
-		return archive.UnZip(&r.Reader, extractDest)
+func patchFile(path string, patch func(string) (string, error)) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
 	}
 
-	if err := unzipSpa(spa, extractDest); err != nil {
+	content, err := patch(string(raw))
+	if err != nil {
 		return err
 	}
 
-	if !vars.Mirror {
-		spaBak := spa + ".bak"
-		logger.Infof("Moving %s -> %s", spa, spaBak)
+	return os.WriteFile(path, []byte(content), 0700)
+}
 
-		if err := os.Rename(spa, spaBak); err != nil {
-			return err
+func linkFiles(destXpuiPath string) []linkStep {
+	folders := []string{"hooks", "modules", "store"}
+	links := make([]linkStep, len(folders))
+	for i, folder := range folders {
+		links[i] = linkStep{
+			Link:   filepath.Join(destXpuiPath, folder),
+			Target: filepath.Join(paths.ConfigPath, folder),
 		}
 	}
-	return nil
+	return links
 }
 
-func patchFile(path string, patch func(string) string) error {
-	raw, err := os.ReadFile(path)
+// resolveSpaSource prefers the spa shipped by Spotify, falling back to the backup made by a previous apply
+func resolveSpaSource(src string, name string) (spa string, fromBackup bool, err error) {
+	spa = filepath.Join(src, name+".spa")
+	if paths.EnsurePath(spa) {
+		return spa, false, nil
+	}
+	if paths.EnsurePath(spa + ".bak") {
+		return spa + ".bak", true, nil
+	}
+	return "", false, fmt.Errorf("can't find %s.spa nor its backup in %s", name, src)
+}
+
+func planApply() (*applyPlan, error) {
+	src, dest := getApps()
+
+	previous, err := readApplyState()
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to read apply state: %w", err)
 	}
 
-	content := patch(string(raw))
+	spotifyVersion := getSpotifyVersion()
+	plan := &applyPlan{
+		Mode:     applyModeReapply,
+		Snapshot: &snapshotStep{SpotifyVersion: spotifyVersion, Spas: map[string]string{}},
+		State: applyState{
+			SpotifyVersion: spotifyVersion,
+			Spas:           map[string]string{},
+			HooksVersion:   getHooksVersion(),
+			Mirror:         vars.Mirror,
+			Dest:           dest,
+		},
+	}
 
-	return os.WriteFile(path, []byte(content), 0700)
-}
+	if err := plan.checkCompatibility(spotifyVersion, applyForce); err != nil {
+		return nil, err
+	}
 
-func patchIndexHtml(destXpuiPath string, logger *log.Logger) error {
-	logger.Info("Patching xpui/index.html")
-	return patchFile(filepath.Join(destXpuiPath, "index.html"), func(s string) string {
-		return strings.Replace(s, `<script defer="defer" src="/vendor~xpui.js"></script><script defer="defer" src="/xpui.js"></script>`, `<script type="module" src="./hooks/index.js"></script>`, 1)
-	})
-}
+	mixins, err := loadMixins()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load mixins: %w", err)
+	}
+	spaMixins, err := groupMixins(mixins)
+	if err != nil {
+		return nil, err
+	}
+	plan.State.Mixins = mixinModules(mixins)
 
-func linkFiles(destXpuiPath string, logger *log.Logger) error {
-	folders := []string{"hooks", "modules", "store"}
-	for _, folder := range folders {
-		folderSrcPath := filepath.Join(paths.ConfigPath, folder)
-		folderDestPath := filepath.Join(destXpuiPath, folder)
-		logger.Infof("Linking %s -> %s", folderDestPath, folderSrcPath)
-
-		os.Remove(folderDestPath)
-		if err := link.Create(folderSrcPath, folderDestPath); err != nil {
-			return err
+	userPatches, err := loadUserPatches()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cfg := range vars.Spas {
+		spa, fromBackup, err := resolveSpaSource(src, cfg.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !fromBackup {
+			plan.Mode = applyModeExtract
+		}
+		plan.Snapshot.Spas[cfg.Name] = spa
+
+		var patches []filePatch
+		if cfg.Has("hooks") {
+			patches = append(patches, hooksIndexHtmlPatch(spotifyVersion))
+		}
+		if mixins := spaMixins[cfg.Name]; len(mixins) > 0 {
+			patches = append(patches, mixinsPatch(mixins))
+		}
+		if cfg.Has("user") {
+			patches = append(patches, userPatches[cfg.Name]...)
+			delete(userPatches, cfg.Name)
+		}
+
+		if err := plan.addSpa(cfg.Name, spa, dest, patches, !vars.Mirror && !fromBackup); err != nil {
+			return nil, fmt.Errorf("failed to plan %s.spa: %w", cfg.Name, err)
+		}
+
+		if cfg.Has("hooks") {
+			plan.Links = append(plan.Links, linkFiles(filepath.Join(dest, cfg.Name))...)
 		}
 	}
-	return nil
+
+	for name, patches := range userPatches {
+		return nil, fmt.Errorf("patch %s targets %s.spa, which isn't configured for user patches", patches[0].ID, name)
+	}
+
+	plan.skipExtraction(previous)
+
+	return plan, nil
 }
 
-func execApply(logger *log.Logger) error {
-	src, dest := getApps()
+var userPatchesPath = filepath.Join(paths.ConfigPath, "patches.json")
 
-	spa := filepath.Join(src, "xpui.spa")
-	if err := extractSpa(spa, dest, logger); err != nil {
-		return fmt.Errorf("failed to extract xpui.spa: %w", err)
+// loadUserPatches compiles the rules of patches.json, grouped by the spa they target
+func loadUserPatches() (map[string][]filePatch, error) {
+	rules, err := patch.Load(userPatchesPath)
+	if err != nil {
+		return nil, err
 	}
 
-	destXpuiPath := filepath.Join(dest, "xpui")
-	if err := patchIndexHtml(destXpuiPath, logger); err != nil {
-		return fmt.Errorf("failed to patch index.html: %w", err)
+	patches := map[string][]filePatch{}
+	for _, rule := range rules {
+		compiled, err := rule.Compile()
+		if err != nil {
+			return nil, err
+		}
+		spa := rule.TargetSpa()
+		patches[spa] = append(patches[spa], rulePatch(compiled))
 	}
+	return patches, nil
+}
 
-	if err := linkFiles(destXpuiPath, logger); err != nil {
-		return fmt.Errorf("failed to link files: %w", err)
+func execApply(logger *log.Logger) error {
+	plan, err := planApply()
+	if err != nil {
+		return err
 	}
+	if err := plan.execute(logger); err != nil {
+		return err
+	}
+	return resumeAutoApply()
+}
+
+func (s *linkStep) execute(logger *log.Logger) error {
+	logger.Infof("Linking %s -> %s", s.Link, s.Target)
 
-	return nil
+	os.Remove(s.Link)
+	return link.Create(s.Target, s.Link)
 }
@@ -0,0 +1,149 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Delusoire/bespoke-cli/v3/backup"
+	"github.com/Delusoire/bespoke-cli/v3/cmd/vars"
+	"github.com/Delusoire/bespoke-cli/v3/paths"
+
+	"github.com/spf13/cobra"
+)
+
+var snapshots = backup.Store{Dir: filepath.Join(paths.ConfigPath, "backups")}
+
+var (
+	backupJson bool
+	backupKeep int
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Manage the snapshots of stock spa files taken before each apply",
+}
+
+var backupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List snapshots, newest first",
+	Run: func(cmd *cobra.Command, args []string) {
+		manifests, err := snapshots.List()
+		if err != nil {
+			rootLogger.Fatal(err)
+		}
+
+		if backupJson {
+			if manifests == nil {
+				manifests = []backup.Manifest{}
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "\t")
+			if err := enc.Encode(manifests); err != nil {
+				rootLogger.Fatal(err)
+			}
+			return
+		}
+
+		for _, m := range manifests {
+			names := make([]string, 0, len(m.Files))
+			for name := range m.Files {
+				names = append(names, name+".spa")
+			}
+			sort.Strings(names)
+			fmt.Printf("%s\tSpotify %s\t%s\t%s\n", m.ID, m.SpotifyVersion, m.CreatedAt.Local().Format(time.DateTime), strings.Join(names, ", "))
+		}
+	},
+}
+
+var backupRestoreCmd = &cobra.Command{
+	Use:   "restore [id]",
+	Short: "Restore the stock spa files of a snapshot, by default the newest one of the installed Spotify version",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if vars.Mirror {
+			rootLogger.Fatal(errors.New("mirror mode never modifies the Spotify installation, use fix instead"))
+		}
+
+		var (
+			snapshot *backup.Manifest
+			err      error
+		)
+		if len(args) > 0 {
+			snapshot, err = snapshots.Get(args[0])
+		} else {
+			snapshot, err = snapshots.Match(getSpotifyVersion())
+		}
+		if err != nil {
+			rootLogger.Fatal(err)
+		}
+
+		if err := removeApplyState(); err != nil {
+			rootLogger.Warn(err)
+		}
+		// the daemon would otherwise apply the restored spa files right away
+		if err := pauseAutoApply(); err != nil {
+			rootLogger.Fatal(err)
+		}
+
+		apps := paths.GetSpotifyAppsPath(vars.SpotifyDataPath)
+		restored := 0
+		for name := range snapshot.Files {
+			if err := restoreSnapshotFile(snapshot, name, apps); err != nil {
+				// the daemon keeps applying as long as the spa files weren't touched
+				if restored == 0 {
+					resumeAutoApply()
+				}
+				rootLogger.Fatalf("failed to restore %s.spa: %s", name, err)
+			}
+			restored++
+		}
+		rootLogger.Info("Restored snapshot", "id", snapshot.ID, "spotify", snapshot.SpotifyVersion)
+	},
+}
+
+var backupPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove all but the newest snapshots",
+	Run: func(cmd *cobra.Command, args []string) {
+		removed, err := snapshots.Prune(backupKeep)
+		if err != nil {
+			rootLogger.Fatal(err)
+		}
+		for _, m := range removed {
+			rootLogger.Info("Removed snapshot", "id", m.ID, "spotify", m.SpotifyVersion)
+		}
+	},
+}
+
+func init() {
+	backupListCmd.Flags().BoolVar(&backupJson, "json", false, "print the snapshots as JSON")
+	backupPruneCmd.Flags().IntVar(&backupKeep, "keep", 3, "number of snapshots to keep")
+
+	backupCmd.AddCommand(backupListCmd, backupRestoreCmd, backupPruneCmd)
+}
+
+// restoreSnapshotFile replaces the patched spa called name in apps with its stock version from snapshot
+func restoreSnapshotFile(snapshot *backup.Manifest, name string, apps string) error {
+	spa := filepath.Join(apps, name+".spa")
+	if err := snapshots.RestoreFile(snapshot, name, spa); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(apps, name)); err != nil {
+		return err
+	}
+	if err := os.Remove(spa + ".bak"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Delusoire/bespoke-cli/v3/cmd/vars"
+	"github.com/Delusoire/bespoke-cli/v3/compat"
+	"github.com/Delusoire/bespoke-cli/v3/module"
+	"github.com/Delusoire/bespoke-cli/v3/paths"
+)
+
+var errIncompatible = errors.New("incompatible Spotify version")
+
+func getSpotifyVersion() string {
+	version, _, _ := paths.DetectSpotifyVersion(vars.SpotifyDataPath, vars.SpotifyExecPath, vars.SpotifyConfigPath)
+	return version
+}
+
+// checkSpotifyCompatibility validates spotifyVersion against the engines declared by what, passing when either is unknown
+func checkSpotifyCompatibility(what string, engines map[string]string, spotifyVersion string) error {
+	declared := engines["spotify"]
+	if declared == "" || spotifyVersion == "" {
+		return nil
+	}
+
+	r, err := compat.ParseRange(declared)
+	if err != nil {
+		return fmt.Errorf("%s declares an %w", what, err)
+	}
+	v, err := compat.ParseVersion(spotifyVersion)
+	if err != nil {
+		return err
+	}
+	if !r.Contains(v) {
+		return fmt.Errorf("%w: %s supports Spotify %s, found %s", errIncompatible, what, r, spotifyVersion)
+	}
+	return nil
+}
+
+// checkCompatibility refuses hooks and mixins which don't support spotifyVersion, other modules only get a warning
+func (p *applyPlan) checkCompatibility(spotifyVersion string, force bool) error {
+	if spotifyVersion == "" {
+		p.Warnings = append(p.Warnings, "couldn't detect the Spotify version, skipping compatibility checks")
+		return nil
+	}
+
+	var errs []error
+	if pkg, err := readHooksPackage(hooksPath); err == nil {
+		if err := checkSpotifyCompatibility("hooks "+pkg.Version, pkg.Engines, spotifyVersion); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	modules, err := module.GetEnabledModules()
+	if err != nil {
+		return err
+	}
+	for _, m := range modules {
+		err := checkSpotifyCompatibility(m.Identifier.String(), m.Metadata.Engines, spotifyVersion)
+		if err == nil {
+			continue
+		}
+		if m.Metadata.HasMixins {
+			errs = append(errs, err)
+		} else {
+			p.Warnings = append(p.Warnings, err.Error())
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	if force {
+		for _, err := range errs {
+			p.Warnings = append(p.Warnings, err.Error())
+		}
+		return nil
+	}
+	return fmt.Errorf("%w\nuse --force to apply anyway", errors.Join(errs...))
+}
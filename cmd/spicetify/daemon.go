@@ -7,18 +7,24 @@ package spicetify
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/cookiejar"
-	"net/http/httputil"
 	"net/url"
 	"os"
-	"strings"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/Delusoire/bespoke-cli/v3/cmd/vars"
+	"github.com/Delusoire/bespoke-cli/v3/module"
+	"github.com/Delusoire/bespoke-cli/v3/network"
 	"github.com/Delusoire/bespoke-cli/v3/paths"
+	"github.com/Delusoire/bespoke-cli/v3/proxy"
 	"github.com/charmbracelet/log"
 
 	"github.com/fsnotify/fsnotify"
@@ -77,77 +83,224 @@ var daemonDisableCmd = &cobra.Command{
 }
 
 func init() {
-	daemonCmd.AddCommand(daemonStartCmd, daemonEnableCmd, daemonDisableCmd)
+	daemonCmd.AddCommand(daemonStartCmd, daemonStopCmd, daemonStatusCmd, daemonEnableCmd, daemonDisableCmd)
 }
 
+func reconcileVault(logger *log.Logger) {
+	changes, err := module.Reconcile(module.ReconcileOptions{})
+	for _, change := range changes {
+		logger.Info(change)
+	}
+	if err != nil {
+		logger.Warnf("failed to reconcile vault: %s", err)
+	}
+	warnIfReapplyNeeded(logger)
+}
+
+// daemonShutdownTimeout bounds how long in-flight requests and RPC get to finish once the daemon stops
+const daemonShutdownTimeout = 10 * time.Second
+
 func startDaemon(logger *log.Logger) {
-	c := make(chan struct{})
-	var (
-		watcherCtx    context.Context
-		watcherCancel context.CancelFunc
-	)
-
-	startWatcher := func() {
-		watcherCtx, watcherCancel = context.WithCancel(context.Background())
-		go watchSpotifyApps(watcherCtx, vars.SpotifyDataPath, logger.WithPrefix("Watcher"))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := runDaemon(ctx, logger); err != nil {
+		logger.Fatal(err)
 	}
+}
 
-	viper.OnConfigChange(func(in fsnotify.Event) {
-		restartWatcher := false
-
-		_daemon := viper.GetBool("daemon")
-		_mirror := viper.GetBool("mirror")
-		_spotifyDataPath := viper.GetString("spotify-data-path")
-		_spotifyExecPath := viper.GetString("spotify-exec-path")
-		_spotifyConfigPath := viper.GetString("spotify-config-path")
-
-		if _spotifyDataPath != vars.SpotifyDataPath {
-			if watcherCancel != nil {
-				// TODO: wait for watcher to stop
-				watcherCancel()
-			}
-			restartWatcher = true
-		}
+type daemon struct {
+	token     string
+	startedAt time.Time
+	logger    *log.Logger
+	stop      context.CancelFunc
+	apps      watchLoop
+	vault     watchLoop
+
+	mu      sync.Mutex
+	closing bool
+	conns   map[*wsClient]struct{}
+	clients sync.WaitGroup
+}
 
-		vars.Daemon = _daemon
-		vars.Mirror = _mirror
-		vars.SpotifyDataPath = _spotifyDataPath
-		vars.SpotifyExecPath = _spotifyExecPath
-		vars.SpotifyConfigPath = _spotifyConfigPath
+var watchConfigOnce sync.Once
 
-		if !vars.Daemon {
-			close(c)
-		}
+// runDaemon serves until ctx is done or the daemon gets stopped or disabled, then shuts down gracefully
+func runDaemon(ctx context.Context, logger *log.Logger) error {
+	startedAt := time.Now().UTC()
+	lock, err := acquireDaemonLock(startedAt)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	reconcileVault(logger.WithPrefix("Vault"))
+
+	token, err := ensureDaemonToken()
+	if err != nil {
+		return fmt.Errorf("failed to read daemon token: %w", err)
+	}
+	loadAllowedOrigins()
+	if err := loadProxyPolicy(); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", DaemonAddr)
+	if err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	d := &daemon{
+		token:     token,
+		startedAt: startedAt,
+		logger:    logger,
+		stop:      stop,
+		conns:     map[*wsClient]struct{}{},
+	}
+
+	mux := http.NewServeMux()
+	d.setupProxy(mux)
+	d.setupWebSocket(mux)
+	d.setupControl(mux)
+	server := &http.Server{Handler: mux}
+	server.RegisterOnShutdown(d.closeClients)
 
-		if restartWatcher {
-			startWatcher()
+	d.startAppsWatcher(ctx)
+	d.vault.start(ctx, func(ctx context.Context) {
+		d.watchVault(ctx, logger.WithPrefix("Vault"))
+	})
+	viper.OnConfigChange(func(in fsnotify.Event) {
+		if ctx.Err() == nil {
+			d.reloadConfig(ctx)
 		}
 	})
+	watchConfigOnce.Do(func() { go viper.WatchConfig() })
 
-	go viper.WatchConfig()
-	startWatcher()
+	served := make(chan error, 1)
 	go func() {
-		setupProxy(logger.WithPrefix("Proxy"))
-		setupWebSocket(logger.WithPrefix("WebSocket"))
-		err := http.ListenAndServe(DaemonAddr, nil)
-		logger.Fatalf("failed to start server: %s", err)
+		served <- server.Serve(listener)
 	}()
 
-	<-c
+	select {
+	case <-ctx.Done():
+	case err = <-served:
+		err = fmt.Errorf("server failed: %w", err)
+	}
+
+	logger.Info("Stopping daemon")
+	stop()
+	d.apps.stop()
+	d.vault.stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), daemonShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Warnf("failed to drain requests: %s", err)
+	}
+	d.waitClients(shutdownCtx)
+
+	return err
+}
+
+func (d *daemon) reloadConfig(ctx context.Context) {
+	_daemon := viper.GetBool("daemon")
+	_mirror := viper.GetBool("mirror")
+	_spotifyDataPath := viper.GetString("spotify-data-path")
+	_spotifyExecPath := viper.GetString("spotify-exec-path")
+	_spotifyConfigPath := viper.GetString("spotify-config-path")
+
+	restartWatcher := _spotifyDataPath != vars.SpotifyDataPath
+
+	vars.Daemon = _daemon
+	vars.Mirror = _mirror
+	vars.SpotifyDataPath = _spotifyDataPath
+	vars.SpotifyExecPath = _spotifyExecPath
+	vars.SpotifyConfigPath = _spotifyConfigPath
+
+	loadAllowedOrigins()
+	if err := loadProxyPolicy(); err != nil {
+		d.logger.Warn(err)
+	}
+
+	if spas, err := vars.LoadSpas(viper.GetViper()); err != nil {
+		d.logger.Warn(err)
+	} else {
+		vars.Spas = spas
+	}
+
+	if config, err := network.LoadConfig(viper.GetViper()); err != nil {
+		d.logger.Warn(err)
+	} else if err := network.Configure(config); err != nil {
+		d.logger.Warn(err)
+	}
+
+	if !vars.Daemon {
+		d.stop()
+		return
+	}
+
+	if restartWatcher {
+		d.startAppsWatcher(ctx)
+	}
+}
+
+func (d *daemon) startAppsWatcher(ctx context.Context) {
+	spotifyDataPath, logger := vars.SpotifyDataPath, d.logger.WithPrefix("Watcher")
+	d.apps.start(ctx, func(ctx context.Context) {
+		watchSpotifyApps(ctx, spotifyDataPath, logger)
+	})
+}
+
+// watchLoop runs a single watch function at a time
+type watchLoop struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// start replaces the running watch function, once it has returned, with watch
+func (w *watchLoop) start(ctx context.Context, watch func(ctx context.Context)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.stopLocked()
+	ctx, w.cancel = context.WithCancel(ctx)
+	w.done = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		watch(ctx)
+	}(w.done)
+}
 
-	os.Exit(0)
+func (w *watchLoop) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopLocked()
+}
+
+func (w *watchLoop) stopLocked() {
+	if w.cancel == nil {
+		return
+	}
+	w.cancel()
+	<-w.done
+	w.cancel, w.done = nil, nil
 }
 
 func watchSpotifyApps(ctx context.Context, spotifyDataPath string, logger *log.Logger) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		logger.Fatal(err)
+		logger.Error(err)
+		return
 	}
 	defer watcher.Close()
 
 	logger.Infof("watching: %s", paths.GetSpotifyAppsPath(spotifyDataPath))
 	if err := watcher.Add(paths.GetSpotifyAppsPath(spotifyDataPath)); err != nil {
-		logger.Fatal(err)
+		logger.Error(err)
+		return
 	}
 
 	for {
@@ -161,7 +314,11 @@ func watchSpotifyApps(ctx context.Context, spotifyDataPath string, logger *log.L
 			}
 			logger.Infof("event: %s", event)
 			if event.Has(fsnotify.Create) {
-				if strings.HasSuffix(event.Name, "xpui.spa") {
+				if isConfiguredSpa(event.Name) {
+					if isAutoApplyPaused() {
+						logger.Info("not applying spa files restored by backup restore or fix, until the next apply")
+						continue
+					}
 					if err := execApply(logger); err != nil {
 						logger.Warn(err)
 					}
@@ -176,86 +333,156 @@ func watchSpotifyApps(ctx context.Context, spotifyDataPath string, logger *log.L
 	}
 }
 
+func isConfiguredSpa(file string) bool {
+	return slices.ContainsFunc(vars.Spas, func(spa vars.Spa) bool {
+		return filepath.Base(file) == spa.Name+".spa"
+	})
+}
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
-		// TODO: improve security
-		return true
+		return isAllowedOrigin(r.Header.Get("Origin"))
 	},
 }
 
-func setupWebSocket(logger *log.Logger) {
-	http.HandleFunc("/rpc", func(w http.ResponseWriter, r *http.Request) {
-		c, err := upgrader.Upgrade(w, r, nil)
+func (d *daemon) setupWebSocket(mux *http.ServeMux) {
+	logger := d.logger.WithPrefix("WebSocket")
+	mux.HandleFunc("/rpc", authorize(d.token, func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			logger.Infof("failed to upgrade: %s", err)
 			return
 		}
-		defer c.Close()
+		defer conn.Close()
+
+		c := &wsClient{Conn: conn}
+
+		if !d.trackClient(c) {
+			return
+		}
+		defer d.untrackClient(c)
 
 		for {
 			_, p, err := c.ReadMessage()
 			if err != nil {
-				logger.Warnf("failed to read: %s", err)
+				if d.isClosing() {
+					c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "daemon stopping"), time.Now().Add(time.Second))
+				} else {
+					logger.Warnf("failed to read: %s", err)
+				}
 				break
 			}
 
 			incoming := string(p)
 			logger.Infof("recv: %s", incoming)
+			if isRPCMessage(p) {
+				if res := HandleRPC(p, &c.session); res != nil {
+					c.write(res)
+				}
+				continue
+			}
 			res, err := HandleProtocol(incoming)
 			if err != nil {
 				logger.Warnf("protocol error: %s", err)
 			}
 			if res != "" {
-				c.WriteMessage(websocket.TextMessage, []byte(res))
+				c.write([]byte(res))
 			}
 		}
-	})
+	}))
 }
 
-func setupProxy(logger *log.Logger) {
-	proxy := (&httputil.ReverseProxy{
-		Transport: &CustomTransport{Transport: http.DefaultTransport},
-		Rewrite: func(r *httputil.ProxyRequest) {
-			p, ok := strings.CutPrefix(r.In.URL.Path, "/proxy/")
-			if !ok {
-				logger.Fatal(errors.New("proxy received invalid path"))
-			}
-			u, err := url.Parse(p)
-			if err != nil {
-				logger.Fatal(fmt.Errorf("proxy received invalid path: %w", err))
-			}
+// trackClient registers c so that shutdown waits for its in-flight message, false once the daemon is stopping
+func (d *daemon) trackClient(c *wsClient) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closing {
+		return false
+	}
+	d.conns[c] = struct{}{}
+	d.clients.Add(1)
+	return true
+}
 
-			r.Out.URL = u
-			r.Out.Host = ""
-
-			xSetHeaders := r.In.Header.Get("X-Set-Headers")
-			r.Out.Header.Del("X-Set-Headers")
-			var headers map[string]string
-			if err := json.Unmarshal([]byte(xSetHeaders), &headers); err == nil {
-				for k, v := range headers {
-					if v == "undefined" {
-						r.Out.Header.Del(k)
-					} else {
-						r.Out.Header.Set(k, v)
-					}
-				}
-			}
-		},
-	})
+func (d *daemon) untrackClient(c *wsClient) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.conns, c)
+	d.clients.Done()
+}
+
+func (d *daemon) isClosing() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.closing
+}
+
+func (d *daemon) clientCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.conns)
+}
+
+// closeClients interrupts the reads of every client, which then leave after answering their in-flight message
+func (d *daemon) closeClients() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closing = true
+	for c := range d.conns {
+		c.SetReadDeadline(time.Now())
+	}
+}
+
+func (d *daemon) waitClients(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		d.clients.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		d.logger.Warn("gave up waiting for websocket clients")
+	}
+}
 
-	http.HandleFunc("/proxy/{url}", func(w http.ResponseWriter, r *http.Request) {
+var proxyPolicy = proxy.NewPolicy(proxy.DefaultConfig())
+
+// proxyTransport follows the network config like every transport, the default config can't fail.
+// Destinations are chosen by web pages, so it never sends the configured credentials
+var proxyTransport, _ = network.NewTransport(network.TransportOptions{Control: proxyPolicy.Control})
+
+func loadProxyPolicy() error {
+	config, err := proxy.LoadConfig(viper.GetViper())
+	if err != nil {
+		return err
+	}
+	proxyPolicy.Configure(config)
+	return nil
+}
+
+func (d *daemon) setupProxy(mux *http.ServeMux) {
+	handler := &proxy.Handler{
+		Prefix:       "/proxy/",
+		Policy:       proxyPolicy,
+		Transport:    &CustomTransport{Transport: proxyTransport},
+		StripHeaders: []string{daemonTokenHeader},
+		Logger:       d.logger.WithPrefix("Proxy"),
+	}
+
+	mux.HandleFunc("/proxy/{url}", authorize(d.token, func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodOptions {
-			w.Header().Set("Access-Control-Allow-Origin", AllowedOrigin)
+			w.Header().Set("Access-Control-Allow-Origin", corsOrigin(r.Header.Get("Origin")))
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Set-Headers")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Set-Headers, "+daemonTokenHeader)
 			w.Header().Set("Access-Control-Max-Age", "86400")
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
-		proxy.ServeHTTP(w, r)
-	})
+		handler.ServeHTTP(w, r)
+	}))
 }
 
 var jar, _ = cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
@@ -282,7 +509,7 @@ func (t *CustomTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 		}
 	}
 
-	resp.Header.Set("Access-Control-Allow-Origin", AllowedOrigin)
+	resp.Header.Set("Access-Control-Allow-Origin", corsOrigin(req.Header.Get("Origin")))
 	resp.Header.Set("Access-Control-Allow-Credentials", "true")
 
 	if loc, err := resp.Location(); err == nil {
@@ -0,0 +1,122 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/Delusoire/bespoke-cli/v3/paths"
+
+	"github.com/spf13/viper"
+)
+
+const daemonTokenHeader = "X-Spicetify-Token"
+
+// daemonTokenPath lives in the modules folder, which apply links into xpui for the hooks to read
+var daemonTokenPath = filepath.Join(paths.ConfigPath, "modules", "daemon.json")
+
+type daemonToken struct {
+	Token string `json:"token"`
+}
+
+func generateDaemonToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(secret)
+
+	content, err := json.Marshal(daemonToken{Token: token})
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(daemonTokenPath), 0755); err != nil {
+		return "", err
+	}
+	return token, os.WriteFile(daemonTokenPath, content, 0600)
+}
+
+func readDaemonToken() (string, error) {
+	raw, err := os.ReadFile(daemonTokenPath)
+	if err != nil {
+		return "", err
+	}
+
+	var t daemonToken
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return "", err
+	}
+	if t.Token == "" {
+		return "", errors.New("daemon token is empty")
+	}
+	return t.Token, nil
+}
+
+// ensureDaemonToken reads the token generated by init, generating one for installs which predate it
+func ensureDaemonToken() (string, error) {
+	token, err := readDaemonToken()
+	if err != nil {
+		return generateDaemonToken()
+	}
+	return token, nil
+}
+
+var allowedOrigins = []string{AllowedOrigin}
+
+func loadAllowedOrigins() {
+	origins := viper.GetStringSlice("daemon-origins")
+	if len(origins) == 0 {
+		origins = []string{AllowedOrigin}
+	}
+	allowedOrigins = origins
+}
+
+// isAllowedOrigin lets requests without an origin through, as only browsers send one and they always do
+func isAllowedOrigin(origin string) bool {
+	return origin == "" || slices.Contains(allowedOrigins, origin)
+}
+
+// corsOrigin is the origin to allow in CORS headers of the response to a request from origin
+func corsOrigin(origin string) string {
+	if origin != "" && isAllowedOrigin(origin) {
+		return origin
+	}
+	return AllowedOrigin
+}
+
+// authorize rejects requests from origins outside of the allowlist, or which don't present the token.
+// Websockets can't send custom headers, so the token may also come in the token query parameter
+func authorize(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAllowedOrigin(r.Header.Get("Origin")) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		// preflights never carry credentials
+		if r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+
+		presented := r.Header.Get(daemonTokenHeader)
+		if presented == "" {
+			presented = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			http.Error(w, "missing or invalid token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Delusoire/bespoke-cli/v3/lockfile"
+	"github.com/Delusoire/bespoke-cli/v3/paths"
+
+	"github.com/spf13/cobra"
+)
+
+var daemonStatusJson bool
+
+var daemonStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the running daemon, letting in-flight requests finish",
+	Run: func(cmd *cobra.Command, args []string) {
+		info, running, err := readDaemonInfo()
+		if err != nil {
+			rootLogger.Fatal(err)
+		}
+		if !running {
+			rootLogger.Info("Daemon isn't running")
+			return
+		}
+
+		if err := stopDaemon(info); err != nil {
+			rootLogger.Fatal(err)
+		}
+		rootLogger.Info("Stopped daemon", "pid", info.PID)
+	},
+}
+
+var daemonStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the daemon is running",
+	Run: func(cmd *cobra.Command, args []string) {
+		status, err := getDaemonStatus()
+		if err != nil {
+			rootLogger.Fatal(err)
+		}
+
+		if daemonStatusJson {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "\t")
+			if err := enc.Encode(status); err != nil {
+				rootLogger.Fatal(err)
+			}
+			return
+		}
+
+		if !status.Running {
+			fmt.Println("not running")
+			return
+		}
+		fmt.Printf("running   pid %d on %s since %s\n", status.PID, status.Addr, status.StartedAt.Local().Format(time.DateTime))
+		if status.Reachable {
+			fmt.Printf("clients   %d\n", status.Clients)
+		} else {
+			fmt.Println("control   unreachable")
+		}
+	},
+}
+
+func init() {
+	daemonStatusCmd.Flags().BoolVar(&daemonStatusJson, "json", false, "print the status as JSON")
+}
+
+// daemonLockPath holds the lock of the running daemon, along with its daemonInfo
+var daemonLockPath = filepath.Join(paths.ConfigPath, "daemon.lock")
+
+type daemonInfo struct {
+	PID       int       `json:"pid"`
+	Addr      string    `json:"addr"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+func acquireDaemonLock(startedAt time.Time) (*lockfile.Lock, error) {
+	content, err := json.Marshal(daemonInfo{PID: os.Getpid(), Addr: DaemonAddr, StartedAt: startedAt})
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := lockfile.Acquire(daemonLockPath, content)
+	if errors.Is(err, lockfile.ErrLocked) {
+		if info, running, _ := readDaemonInfo(); running {
+			return nil, fmt.Errorf("daemon is already running (pid %d)", info.PID)
+		}
+		return nil, errors.New("daemon is already running")
+	}
+	return lock, err
+}
+
+// readDaemonInfo returns the info of the running daemon, nil when it isn't running
+func readDaemonInfo() (*daemonInfo, bool, error) {
+	content, held, err := lockfile.Read(daemonLockPath)
+	if err != nil || !held {
+		return nil, false, err
+	}
+
+	// the daemon may have locked the file without writing to it yet
+	info := daemonInfo{Addr: DaemonAddr}
+	json.Unmarshal(content, &info)
+	return &info, true, nil
+}
+
+type daemonControlStatus struct {
+	daemonInfo
+	Running   bool `json:"running"`
+	Reachable bool `json:"reachable"`
+	Clients   int  `json:"clients"`
+}
+
+func getDaemonStatus() (*daemonControlStatus, error) {
+	info, running, err := readDaemonInfo()
+	if err != nil || !running {
+		return &daemonControlStatus{}, err
+	}
+
+	status := &daemonControlStatus{daemonInfo: *info, Running: true}
+	res, err := daemonControl(info, http.MethodGet, "status")
+	if err != nil {
+		return status, nil
+	}
+	defer res.Body.Close()
+	if err := json.NewDecoder(res.Body).Decode(status); err != nil {
+		return nil, err
+	}
+	status.Reachable = true
+	return status, nil
+}
+
+// stopDaemon asks the daemon to stop, then waits for it to release its lock
+func stopDaemon(info *daemonInfo) error {
+	res, err := daemonControl(info, http.MethodPost, "stop")
+	if err != nil {
+		return fmt.Errorf("failed to reach the daemon (pid %d): %w", info.PID, err)
+	}
+	res.Body.Close()
+
+	deadline := time.Now().Add(daemonShutdownTimeout + 5*time.Second)
+	for time.Now().Before(deadline) {
+		if _, running, err := readDaemonInfo(); err != nil {
+			return err
+		} else if !running {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("daemon (pid %d) didn't stop in time", info.PID)
+}
+
+func daemonControl(info *daemonInfo, method string, action string) (*http.Response, error) {
+	token, err := readDaemonToken()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, "http://"+info.Addr+"/daemon/"+action, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(daemonTokenHeader, token)
+
+	client := http.Client{Timeout: 5 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 300 {
+		res.Body.Close()
+		return nil, fmt.Errorf("daemon answered %s", res.Status)
+	}
+	return res, nil
+}
+
+// setupControl serves the daemon's status and stop endpoints, its local control channel
+func (d *daemon) setupControl(mux *http.ServeMux) {
+	mux.HandleFunc("GET /daemon/status", authorize(d.token, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(daemonControlStatus{
+			daemonInfo: daemonInfo{PID: os.Getpid(), Addr: DaemonAddr, StartedAt: d.startedAt},
+			Running:    true,
+			Clients:    d.clientCount(),
+		})
+	}))
+	mux.HandleFunc("POST /daemon/stop", authorize(d.token, func(w http.ResponseWriter, r *http.Request) {
+		d.logger.Info("Stop requested")
+		w.WriteHeader(http.StatusAccepted)
+		d.stop()
+	}))
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Delusoire/bespoke-cli/v3/module"
+	"github.com/Delusoire/bespoke-cli/v3/paths"
+	"github.com/charmbracelet/log"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gorilla/websocket"
+)
+
+// vaultDebounce groups the writes of a single vault change, e.g. those of a fast-enable
+const vaultDebounce = 250 * time.Millisecond
+
+// wsClient serializes the writes to a websocket, as answers and notifications are written from different goroutines
+type wsClient struct {
+	*websocket.Conn
+	writeMu sync.Mutex
+	session rpcSession
+}
+
+func (c *wsClient) write(message []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	return c.WriteMessage(websocket.TextMessage, message)
+}
+
+type vaultEvent struct {
+	Type module.VaultEventKind `json:"type"`
+	ID   string                `json:"id"`
+	// Module is the new state of the module, null once it's gone from the vault
+	Module *module.Module `json:"module"`
+}
+
+type vaultChange struct {
+	Events []vaultEvent `json:"events"`
+}
+
+// watchVault broadcasts the changes of the vault, however they're made, to the subscribed clients
+func (d *daemon) watchVault(ctx context.Context, logger *log.Logger) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	defer watcher.Close()
+
+	modules := filepath.Join(paths.ConfigPath, "modules")
+	if err := watcher.Add(modules); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	vault, err := module.GetVault()
+	if err != nil {
+		logger.Warnf("failed to read vault: %s", err)
+	}
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Name != daemonTokenPath {
+				debounce = time.After(vaultDebounce)
+			}
+		case <-debounce:
+			debounce = nil
+			next, err := module.GetVault()
+			if err != nil {
+				logger.Warnf("failed to read vault: %s", err)
+				continue
+			}
+			events := module.DiffVaults(vault, next)
+			vault = next
+			if len(events) == 0 {
+				continue
+			}
+			logger.Info("vault changed", "events", len(events))
+			d.broadcast(newVaultChange(next, events))
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Warn(err)
+		}
+	}
+}
+
+func newVaultChange(vault *module.Vault, events []module.VaultEvent) vaultChange {
+	change := vaultChange{Events: make([]vaultEvent, len(events))}
+	for i, event := range events {
+		change.Events[i] = vaultEvent{Type: event.Kind, ID: event.Identifier.String()}
+		if m, ok := vault.Modules[event.Identifier.ModuleIdentifier]; ok {
+			change.Events[i].Module = &m
+		}
+	}
+	return change
+}
+
+// broadcast notifies the subscribed clients of change
+func (d *daemon) broadcast(change vaultChange) {
+	message, err := json.Marshal(rpcNotification{JSONRPC: "2.0", Method: "vault.changed", Params: change})
+	if err != nil {
+		d.logger.Warn(err)
+		return
+	}
+
+	d.mu.Lock()
+	var subscribed []*wsClient
+	for c := range d.conns {
+		if c.session.subscribed.Load() {
+			subscribed = append(subscribed, c)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, c := range subscribed {
+		if err := c.write(message); err != nil {
+			d.logger.Warnf("failed to notify client: %s", err)
+		}
+	}
+}
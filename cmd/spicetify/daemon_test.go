@@ -0,0 +1,306 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Delusoire/bespoke-cli/v3/cmd/vars"
+	"github.com/Delusoire/bespoke-cli/v3/paths"
+	"github.com/charmbracelet/log"
+
+	"github.com/spf13/viper"
+)
+
+const testHomeEnv = "SPICETIFY_TEST_HOME"
+
+// TestMain reruns the tests with a throwaway home, as the config folder is resolved from the environment on init
+func TestMain(m *testing.M) {
+	if home := os.Getenv(testHomeEnv); home != "" {
+		if !strings.HasPrefix(paths.ConfigPath, home) {
+			fmt.Fprintf(os.Stderr, "config folder %s isn't inside of the test home %s\n", paths.ConfigPath, home)
+			os.Exit(1)
+		}
+		// init creates the config folder before the daemon ever runs
+		if err := os.MkdirAll(paths.ConfigPath, 0755); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(m.Run())
+	}
+
+	home, err := os.MkdirTemp("", "spicetify-test-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	cmd := exec.Command(os.Args[0], os.Args[1:]...)
+	cmd.Env = append(os.Environ(),
+		testHomeEnv+"="+home,
+		"HOME="+home,
+		"XDG_CONFIG_HOME="+filepath.Join(home, ".config"),
+		"APPDATA="+filepath.Join(home, "AppData", "Roaming"),
+		"LOCALAPPDATA="+filepath.Join(home, "AppData", "Local"),
+	)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	err = cmd.Run()
+	os.RemoveAll(home)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+type testDaemon struct {
+	cancel context.CancelFunc
+	done   chan error
+}
+
+// startTestDaemon runs the daemon on a free port, letting its proxy reach the loopback test servers
+func startTestDaemon(t *testing.T) *testDaemon {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	previousAddr, previousDataPath := DaemonAddr, vars.SpotifyDataPath
+	DaemonAddr, vars.SpotifyDataPath = addr, t.TempDir()
+	viper.Set("daemon-proxy", map[string]any{"allow-private": true})
+	t.Cleanup(func() {
+		DaemonAddr, vars.SpotifyDataPath = previousAddr, previousDataPath
+		viper.Set("daemon-proxy", nil)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &testDaemon{cancel: cancel, done: make(chan error, 1)}
+	go func() {
+		d.done <- runDaemon(ctx, log.New(io.Discard))
+	}()
+	t.Cleanup(func() {
+		cancel()
+		d.wait(t)
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if info, running, _ := readDaemonInfo(); running {
+			if status, err := getDaemonStatus(); err == nil && status.Reachable && info.Addr == addr {
+				return d
+			}
+		}
+		select {
+		case err := <-d.done:
+			d.done <- err
+			t.Fatalf("daemon exited while starting: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("daemon didn't start in time")
+		}
+	}
+}
+
+// wait returns the error runDaemon returned, it may be called again once it did
+func (d *testDaemon) wait(t *testing.T) error {
+	t.Helper()
+	select {
+	case err := <-d.done:
+		d.done <- err
+		return err
+	case <-time.After(daemonShutdownTimeout + 5*time.Second):
+		t.Fatal("daemon didn't stop in time")
+		return nil
+	}
+}
+
+func (d *testDaemon) running() bool {
+	select {
+	case err := <-d.done:
+		d.done <- err
+		return false
+	default:
+		return true
+	}
+}
+
+func TestDaemonSingleInstance(t *testing.T) {
+	d := startTestDaemon(t)
+
+	err := runDaemon(context.Background(), log.New(io.Discard))
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("already running (pid %d)", os.Getpid())) {
+		t.Fatalf("second runDaemon() = %v, want already running", err)
+	}
+	if !d.running() {
+		t.Fatal("refusing a second start stopped the running daemon")
+	}
+
+	info, running, err := readDaemonInfo()
+	if err != nil || !running {
+		t.Fatalf("readDaemonInfo() = %v, %t, %v", info, running, err)
+	}
+	if err := stopDaemon(info); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.wait(t); err != nil {
+		t.Fatalf("runDaemon() = %v after /daemon/stop", err)
+	}
+	if _, running, err := readDaemonInfo(); err != nil || running {
+		t.Fatalf("daemon still reported running after stopping: %t, %v", running, err)
+	}
+
+	// the lock is released for the next daemon
+	startTestDaemon(t)
+}
+
+func TestDaemonDrainsInFlightRequests(t *testing.T) {
+	received, release := make(chan struct{}), make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-release
+		w.Write([]byte("drained"))
+	}))
+	defer upstream.Close()
+
+	d := startTestDaemon(t)
+	token, err := readDaemonToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	results := make(chan result, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+DaemonAddr+"/proxy/"+url.PathEscape(upstream.URL), nil)
+		req.Header.Set(daemonTokenHeader, token)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		results <- result{res.StatusCode, string(body), err}
+	}()
+
+	select {
+	case <-received:
+	case r := <-results:
+		t.Fatalf("proxied request didn't reach upstream: %+v", r)
+	}
+
+	info, _, err := readDaemonInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := daemonControl(info, http.MethodPost, "stop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	time.Sleep(200 * time.Millisecond)
+	if !d.running() {
+		t.Fatal("daemon stopped before its in-flight request finished")
+	}
+
+	close(release)
+	if r := <-results; r.err != nil || r.status != http.StatusOK || r.body != "drained" {
+		t.Fatalf("in-flight request = %+v, want 200 \"drained\"", r)
+	}
+	if err := d.wait(t); err != nil {
+		t.Fatalf("runDaemon() = %v after /daemon/stop", err)
+	}
+}
+
+// syncBuffer collects the output of a logger shared with a watcher goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// waitFor polls until the buffer holds s
+func (b *syncBuffer) waitFor(t *testing.T, s string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		b.mu.Lock()
+		found := strings.Contains(b.buf.String(), s)
+		b.mu.Unlock()
+		if found {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("%q wasn't logged", s)
+}
+
+func TestAppsWatcherRespectsRestore(t *testing.T) {
+	dataPath := t.TempDir()
+	apps := paths.GetSpotifyAppsPath(dataPath)
+	if err := os.MkdirAll(apps, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	previousSpas := vars.Spas
+	vars.Spas = []vars.Spa{{Name: "xpui", Patches: []string{"hooks"}}}
+	t.Cleanup(func() { vars.Spas = previousSpas })
+
+	if err := pauseAutoApply(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resumeAutoApply() })
+
+	var buf syncBuffer
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchSpotifyApps(ctx, dataPath, log.New(&buf))
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	buf.waitFor(t, "watching")
+	if err := os.WriteFile(filepath.Join(apps, "xpui.spa"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	buf.waitFor(t, "not applying spa files restored")
+}
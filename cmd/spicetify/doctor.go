@@ -0,0 +1,295 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/Delusoire/bespoke-cli/v3/cmd/vars"
+	"github.com/Delusoire/bespoke-cli/v3/module"
+	"github.com/Delusoire/bespoke-cli/v3/paths"
+	"github.com/charmbracelet/log"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var doctorFix bool
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose common problems of the installation",
+	Run: func(cmd *cobra.Command, args []string) {
+		if failed := runDoctor(rootLogger, doctorChecks, doctorFix); failed > 0 {
+			rootLogger.Fatalf("%d checks failed", failed)
+		}
+	},
+}
+
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorFix, "fix", false, "apply the safe repairs of failed checks")
+}
+
+type severity string
+
+const (
+	severityOK      severity = "ok"
+	severityWarning severity = "warning"
+	severityError   severity = "error"
+)
+
+type checkResult struct {
+	Severity severity
+	Message  string
+	Hint     string
+	// Fix is a safe repair of the problem, nil when it needs a human
+	Fix func() error
+}
+
+type doctorCheck struct {
+	Name string
+	Run  func() checkResult
+}
+
+// doctorChecks run in order, add new checks here
+var doctorChecks = []doctorCheck{
+	{"config", checkConfig},
+	{"paths", checkPaths},
+	{"apps", checkAppsWritable},
+	{"vault", checkVault},
+	{"hooks", checkHooks},
+	{"links", checkLinks},
+	{"daemon", checkDaemonPort},
+}
+
+func passed(format string, a ...any) checkResult {
+	return checkResult{Severity: severityOK, Message: fmt.Sprintf(format, a...)}
+}
+
+// runDoctor runs checks, returning the number of failed ones
+func runDoctor(logger *log.Logger, checks []doctorCheck, fix bool) int {
+	failed := 0
+	for _, check := range checks {
+		result := check.Run()
+		if fix && result.Severity != severityOK && result.Fix != nil {
+			logger.Info(check.Name+": repairing", "problem", result.Message)
+			if err := result.Fix(); err != nil {
+				logger.Error(check.Name+": repair failed", "err", err)
+			} else {
+				result = check.Run()
+			}
+		}
+
+		keyvals := []any{}
+		if result.Severity != severityOK {
+			if result.Hint != "" {
+				keyvals = append(keyvals, "hint", result.Hint)
+			}
+			if result.Fix != nil && !fix {
+				keyvals = append(keyvals, "fix", "run doctor --fix")
+			}
+		}
+
+		msg := check.Name + ": " + result.Message
+		switch result.Severity {
+		case severityOK:
+			logger.Info(msg, keyvals...)
+		case severityWarning:
+			logger.Warn(msg, keyvals...)
+		default:
+			failed++
+			logger.Error(msg, keyvals...)
+		}
+	}
+	return failed
+}
+
+func checkConfig() checkResult {
+	if _, err := os.Stat(vars.CfgFile); err != nil {
+		return checkResult{
+			Severity: severityWarning,
+			Message:  fmt.Sprintf("can't read %s: %s", vars.CfgFile, err),
+			Hint:     "run spicetify init",
+			Fix: func() error {
+				return viper.SafeWriteConfigAs(vars.CfgFile)
+			},
+		}
+	}
+
+	v := viper.New()
+	v.SetConfigFile(vars.CfgFile)
+	if err := v.ReadInConfig(); err != nil {
+		return checkResult{
+			Severity: severityError,
+			Message:  fmt.Sprintf("invalid config file: %s", err),
+			Hint:     "fix the syntax of " + vars.CfgFile,
+		}
+	}
+	return passed("%s", vars.CfgFile)
+}
+
+func checkPaths() checkResult {
+	for _, p := range []struct{ key, path string }{
+		{"spotify-data-path", vars.SpotifyDataPath},
+		{"spotify-exec-path", vars.SpotifyExecPath},
+		{"spotify-config-path", vars.SpotifyConfigPath},
+	} {
+		if !paths.EnsurePath(p.path) {
+			return checkResult{
+				Severity: severityError,
+				Message:  fmt.Sprintf("%s %s doesn't exist", p.key, p.path),
+				Hint:     fmt.Sprintf("set %s in %s", p.key, vars.CfgFile),
+			}
+		}
+	}
+
+	version := getSpotifyVersion()
+	if version == "" {
+		return checkResult{
+			Severity: severityWarning,
+			Message:  "couldn't detect the Spotify version",
+			Hint:     "launch Spotify once so that it writes its prefs",
+		}
+	}
+	return passed("Spotify %s in %s", version, vars.SpotifyDataPath)
+}
+
+func checkAppsWritable() checkResult {
+	if vars.Mirror {
+		return passed("mirror mode, Spotify's Apps folder stays untouched")
+	}
+
+	apps := paths.GetSpotifyAppsPath(vars.SpotifyDataPath)
+	f, err := os.CreateTemp(apps, ".spicetify-doctor-*")
+	if err != nil {
+		return checkResult{
+			Severity: severityError,
+			Message:  fmt.Sprintf("can't write to %s: %s", apps, err),
+			Hint:     "use mirror mode with --mirror or `mirror: true` in " + vars.CfgFile,
+		}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return passed("%s is writable", apps)
+}
+
+func checkVault() checkResult {
+	if _, err := module.GetVault(); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return checkResult{
+				Severity: severityError,
+				Message:  "vault.json is missing",
+				Hint:     "run spicetify init",
+				Fix: func() error {
+					return module.SetVault(&module.Vault{Modules: map[module.ModuleIdentifier]module.Module{}})
+				},
+			}
+		}
+		return checkResult{
+			Severity: severityError,
+			Message:  fmt.Sprintf("invalid vault.json: %s", err),
+			Hint:     "fix or remove " + filepath.Join(paths.ConfigPath, "modules", "vault.json"),
+		}
+	}
+	return passed("vault.json is valid")
+}
+
+func checkHooks() checkResult {
+	if _, err := os.Stat(filepath.Join(hooksPath, "index.js")); err != nil {
+		return checkResult{
+			Severity: severityError,
+			Message:  "hooks aren't installed",
+			Hint:     "run spicetify sync",
+			Fix: func() error {
+				_, err := installHooksRelease("", getHooksChannel(), false)
+				return err
+			},
+		}
+	}
+	return passed("hooks %s", getHooksVersion())
+}
+
+func checkLinks() checkResult {
+	_, dest := getApps()
+	xpui := filepath.Join(dest, "xpui")
+	if !paths.EnsurePath(xpui) {
+		return passed("Spotify isn't patched")
+	}
+
+	var broken []linkStep
+	for _, step := range linkFiles(xpui) {
+		if !isLinkValid(step.Link, step.Target) {
+			broken = append(broken, step)
+		}
+	}
+	if len(broken) == 0 {
+		return passed("hooks, modules and store are linked")
+	}
+
+	return checkResult{
+		Severity: severityError,
+		Message:  fmt.Sprintf("%s doesn't link to %s", broken[0].Link, broken[0].Target),
+		Hint:     "run spicetify apply",
+		Fix: func() error {
+			for _, step := range broken {
+				// hooks are only restored by sync, the other folders are mere containers
+				if step.Target != hooksPath {
+					if err := os.MkdirAll(step.Target, 0755); err != nil {
+						return err
+					}
+				}
+				if err := step.execute(log.New(io.Discard)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func checkDaemonPort() checkResult {
+	l, err := net.Listen("tcp", DaemonAddr)
+	if err == nil {
+		l.Close()
+		return passed("%s is free", DaemonAddr)
+	}
+
+	if isOurDaemon() {
+		return passed("the daemon listens on %s", DaemonAddr)
+	}
+	return checkResult{
+		Severity: severityError,
+		Message:  fmt.Sprintf("%s is taken by another program", DaemonAddr),
+		Hint:     "stop the program listening on " + DaemonAddr,
+	}
+}
+
+// isOurDaemon recognizes the daemon by the lock it holds, the token only goes to the address and pid it recorded there
+func isOurDaemon() bool {
+	info, running, err := readDaemonInfo()
+	if err != nil || !running || info.PID == 0 || info.Addr != DaemonAddr {
+		return false
+	}
+
+	res, err := daemonControl(info, http.MethodGet, "status")
+	if err != nil {
+		return false
+	}
+	defer res.Body.Close()
+
+	var status daemonControlStatus
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		return false
+	}
+	return status.Running && status.PID == info.PID
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCheckDaemonPortKeepsTokenFromOtherPrograms(t *testing.T) {
+	token, err := ensureDaemonToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var leaked atomic.Bool
+	squatter := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.String(), token) || strings.Contains(r.Header.Get(daemonTokenHeader), token) {
+			leaked.Store(true)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer squatter.Close()
+
+	previousAddr := DaemonAddr
+	DaemonAddr = strings.TrimPrefix(squatter.URL, "http://")
+	defer func() { DaemonAddr = previousAddr }()
+
+	if result := checkDaemonPort(); result.Severity != severityError {
+		t.Fatalf("checkDaemonPort() = %+v, want an error for another program", result)
+	}
+	if leaked.Load() {
+		t.Fatal("the daemon token was sent to another program")
+	}
+}
+
+func TestCheckDaemonPortRecognizesDaemon(t *testing.T) {
+	startTestDaemon(t)
+
+	if result := checkDaemonPort(); result.Severity == severityError {
+		t.Fatalf("checkDaemonPort() = %+v, want the daemon recognized", result)
+	}
+}
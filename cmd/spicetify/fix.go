@@ -6,11 +6,13 @@
 package spicetify
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/Delusoire/bespoke-cli/v3/backup"
 	"github.com/Delusoire/bespoke-cli/v3/cmd/vars"
 	"github.com/Delusoire/bespoke-cli/v3/paths"
 	"github.com/charmbracelet/log"
@@ -30,27 +32,79 @@ var fixCmd = &cobra.Command{
 }
 
 func execFix(logger *log.Logger) error {
+	if err := removeApplyState(); err != nil {
+		logger.Warn(err)
+	}
+
 	if vars.Mirror {
 		os.RemoveAll(filepath.Join(paths.ConfigPath, "apps"))
-	} else {
-		spaBakGlob := filepath.Join(paths.GetSpotifyAppsPath(vars.SpotifyDataPath), "*.spa.bak")
-		spaBaks, err := filepath.Glob(spaBakGlob)
-		if err != nil {
+		return nil
+	}
+
+	// the daemon would otherwise apply the restored spa files right away, it's paused once there's something to restore
+	paused := false
+	pause := func() error {
+		if paused {
+			return nil
+		}
+		paused = true
+		return pauseAutoApply()
+	}
+
+	apps := paths.GetSpotifyAppsPath(vars.SpotifyDataPath)
+	spaBaks, err := filepath.Glob(filepath.Join(apps, "*.spa.bak"))
+	if err != nil {
+		return err
+	}
+
+	restored := 0
+	for _, spaBak := range spaBaks {
+		spa := strings.TrimSuffix(spaBak, ".bak")
+		if err := pause(); err != nil {
 			return err
 		}
-		if len(spaBaks) == 0 {
-			return fmt.Errorf("Spotify is already in stock state!")
+		if err = os.RemoveAll(strings.TrimSuffix(spa, ".spa")); err != nil {
+			logger.Warn(err)
+		}
+		if err = os.Rename(spaBak, spa); err != nil {
+			logger.Errorf("failed to restore %s: %s", spaBak, err)
+			continue
 		}
+		restored++
+	}
 
-		for _, spaBak := range spaBaks {
-			spa := strings.TrimSuffix(spaBak, ".bak")
-			if err = os.RemoveAll(strings.TrimSuffix(spa, ".spa")); err != nil {
-				logger.Warn(err)
+	// spa files without a backup were lost, e.g. to an update racing with apply
+	spotifyVersion := getSpotifyVersion()
+	snapshot, err := snapshots.Match(spotifyVersion)
+	if err != nil {
+		if !errors.Is(err, backup.ErrNotFound) {
+			logger.Warn(err)
+		}
+	} else {
+		for name := range snapshot.Files {
+			spa := filepath.Join(apps, name+".spa")
+			if paths.EnsurePath(spa) {
+				continue
+			}
+			logger.Infof("Restoring %s from snapshot %s", spa, snapshot.ID)
+			if err := pause(); err != nil {
+				return err
 			}
-			if err = os.Rename(spaBak, spa); err != nil {
-				logger.Errorf("failed to restore %s: %s", spaBak, err)
+			if err := restoreSnapshotFile(snapshot, name, apps); err != nil {
+				logger.Errorf("failed to restore %s: %s", spa, err)
+				continue
+			}
+			restored++
+		}
+	}
+
+	if restored == 0 {
+		if paused {
+			if err := resumeAutoApply(); err != nil {
+				logger.Warn(err)
 			}
 		}
+		return fmt.Errorf("Spotify is already in stock state!")
 	}
 
 	return nil
@@ -0,0 +1,53 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Delusoire/bespoke-cli/v3/cmd/vars"
+	"github.com/Delusoire/bespoke-cli/v3/paths"
+	"github.com/charmbracelet/log"
+)
+
+func TestFixPausesAutoApplyOnlyWhenRestoring(t *testing.T) {
+	dataPath := t.TempDir()
+	apps := paths.GetSpotifyAppsPath(dataPath)
+	if err := os.MkdirAll(apps, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	previousDataPath, previousMirror := vars.SpotifyDataPath, vars.Mirror
+	vars.SpotifyDataPath, vars.Mirror = dataPath, false
+	t.Cleanup(func() {
+		vars.SpotifyDataPath, vars.Mirror = previousDataPath, previousMirror
+		resumeAutoApply()
+	})
+	logger := log.New(io.Discard)
+
+	if err := execFix(logger); err == nil {
+		t.Fatal("execFix() of a stock installation succeeded")
+	}
+	if isAutoApplyPaused() {
+		t.Fatal("auto apply paused although nothing was restored")
+	}
+
+	if err := os.WriteFile(filepath.Join(apps, "xpui.spa.bak"), []byte("stock"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := execFix(logger); err != nil {
+		t.Fatal(err)
+	}
+	if !isAutoApplyPaused() {
+		t.Fatal("auto apply not paused after restoring xpui.spa")
+	}
+	if content, err := os.ReadFile(filepath.Join(apps, "xpui.spa")); err != nil || string(content) != "stock" {
+		t.Fatalf("xpui.spa = %q, %v", content, err)
+	}
+}
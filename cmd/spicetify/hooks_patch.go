@@ -0,0 +1,125 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var errPatchNotMatched = errors.New("patch target not found")
+
+const hooksScriptTag = `<script type="module" src="./hooks/index.js"></script>`
+
+// knownXpuiScriptTags lists the exact markup of the xpui script tags shipped by past Spotify versions, newest first
+var knownXpuiScriptTags = []struct {
+	name string
+	tags string
+}{
+	{"defer-attr", `<script defer="defer" src="/vendor~xpui.js"></script><script defer="defer" src="/xpui.js"></script>`},
+	{"defer-bool", `<script defer src="/vendor~xpui.js"></script><script defer src="/xpui.js"></script>`},
+}
+
+var xpuiScriptRe = regexp.MustCompile(`^(vendor~)?xpui([-.~][\w.~-]*)?\.js$`)
+
+func hooksIndexHtmlPatch(spotifyVersion string) filePatch {
+	return filePatch{
+		ID: "hooks",
+		Match: func(name string) bool {
+			return name == "index.html"
+		},
+		Patch: func(name string, s string) (string, patchResult, error) {
+			for _, known := range knownXpuiScriptTags {
+				if strings.Contains(s, known.tags) {
+					return strings.Replace(s, known.tags, hooksScriptTag, 1), patchResult{Matches: 1, Via: known.name}, nil
+				}
+			}
+
+			regions := findXpuiScriptTags(s)
+			if len(regions) == 0 {
+				version := spotifyVersion
+				if version == "" {
+					version = "(unknown version)"
+				}
+				return s, patchResult{}, fmt.Errorf("couldn't find the xpui script tags in index.html of Spotify %s: %w", version, errPatchNotMatched)
+			}
+
+			var sb strings.Builder
+			last := 0
+			for i, r := range regions {
+				sb.WriteString(s[last:r[0]])
+				if i == 0 {
+					sb.WriteString(hooksScriptTag)
+				}
+				last = r[1]
+			}
+			sb.WriteString(s[last:])
+
+			return sb.String(), patchResult{Matches: len(regions), Via: "html"}, nil
+		},
+		Check: func(total int) error {
+			if total == 0 {
+				return fmt.Errorf("couldn't find index.html in xpui: %w", errPatchNotMatched)
+			}
+			return nil
+		},
+	}
+}
+
+// findXpuiScriptTags returns the byte ranges of the <script> elements loading the xpui bundles
+func findXpuiScriptTags(s string) [][2]int {
+	var regions [][2]int
+
+	z := html.NewTokenizer(strings.NewReader(s))
+	offset := 0
+	open := -1
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				return nil
+			}
+			return regions
+		}
+		start := offset
+		offset += len(z.Raw())
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if !bytes.Equal(name, []byte("script")) || !hasAttr {
+				continue
+			}
+			for {
+				key, val, more := z.TagAttr()
+				if string(key) == "src" && xpuiScriptRe.MatchString(path.Base(string(val))) {
+					if tt == html.SelfClosingTagToken {
+						regions = append(regions, [2]int{start, offset})
+					} else {
+						open = start
+					}
+					break
+				}
+				if !more {
+					break
+				}
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if open != -1 && bytes.Equal(name, []byte("script")) {
+				regions = append(regions, [2]int{open, offset})
+				open = -1
+			}
+		}
+	}
+}
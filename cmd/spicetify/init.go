@@ -49,5 +49,9 @@ func execInit(logger *log.Logger) error {
 		return fmt.Errorf("failed to initialize vault: %w", err)
 	}
 
+	if _, err := generateDaemonToken(); err != nil {
+		return fmt.Errorf("failed to generate daemon token: %w", err)
+	}
+
 	return nil
 }
@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+
+	"github.com/Delusoire/bespoke-cli/v3/cmd/vars"
+	"github.com/Delusoire/bespoke-cli/v3/module"
+	"github.com/Delusoire/bespoke-cli/v3/patch"
+)
+
+type compiledMixin struct {
+	// module identifies the module providing the rule as author/name@version
+	module string
+	// owner identifies the rule as author/name@version:rule
+	owner string
+	rule  *patch.Compiled
+}
+
+// loadMixins compiles the mixins of enabled modules, ordered by module
+func loadMixins() ([]compiledMixin, error) {
+	enabled, err := module.GetEnabledMixins()
+	if err != nil {
+		return nil, err
+	}
+
+	var mixins []compiledMixin
+	for _, m := range enabled {
+		for _, rule := range m.Rules {
+			compiled, err := rule.Compile()
+			if err != nil {
+				return nil, err
+			}
+			mixins = append(mixins, compiledMixin{module: m.Identifier.String(), owner: m.Identifier.String() + ":" + rule.Name, rule: compiled})
+		}
+	}
+	return mixins, nil
+}
+
+// groupMixins groups mixins by the spa they target, which like for user patches must be configured for mixins
+func groupMixins(mixins []compiledMixin) (map[string][]compiledMixin, error) {
+	spaMixins := map[string][]compiledMixin{}
+	for _, m := range mixins {
+		spa := m.rule.TargetSpa()
+		if !slices.ContainsFunc(vars.Spas, func(cfg vars.Spa) bool { return cfg.Name == spa && cfg.Has("mixins") }) {
+			return nil, fmt.Errorf("mixin %s targets %s.spa, which isn't configured for mixins", m.owner, spa)
+		}
+		spaMixins[spa] = append(spaMixins[spa], m)
+	}
+	return spaMixins, nil
+}
+
+// mixinModules lists the modules providing mixins, the ones recorded in the applied state
+func mixinModules(mixins []compiledMixin) []string {
+	var modules []string
+	for _, m := range mixins {
+		modules = append(modules, m.module)
+	}
+	return slices.Compact(modules)
+}
+
+// mixinsPatch applies every mixin against the same original content, so that edits of the same region conflict
+func mixinsPatch(mixins []compiledMixin) filePatch {
+	h := sha256.New()
+	for _, m := range mixins {
+		h.Write([]byte(m.owner + "@" + m.rule.Fingerprint() + "\n"))
+	}
+
+	totals := map[string]int{}
+
+	return filePatch{
+		ID:          "mixins",
+		Fingerprint: hex.EncodeToString(h.Sum(nil)[:4]),
+		Match: func(name string) bool {
+			return slices.ContainsFunc(mixins, func(m compiledMixin) bool {
+				return m.rule.MatchFile(name)
+			})
+		},
+		Patch: func(name string, s string) (string, patchResult, error) {
+			var edits []patch.Edit
+			for _, m := range mixins {
+				if !m.rule.MatchFile(name) {
+					continue
+				}
+				found := m.rule.Find(s)
+				for i := range found {
+					found[i].Owner = m.owner
+				}
+				totals[m.owner] += len(found)
+				edits = append(edits, found...)
+			}
+
+			patched, err := patch.Apply(s, edits)
+			return patched, patchResult{Matches: len(edits)}, err
+		},
+		Check: func(int) error {
+			defer clear(totals)
+			for _, m := range mixins {
+				if err := m.rule.Check(totals[m.owner]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// markReapplyIfMixinsChanged flags the applied state while the enabled mixins differ from the applied ones
+func markReapplyIfMixinsChanged() (bool, error) {
+	state, err := readApplyState()
+	if err != nil || state == nil {
+		return false, err
+	}
+
+	mixins, err := loadMixins()
+	if err != nil {
+		return false, err
+	}
+
+	stale := !slices.Equal(mixinModules(mixins), state.Mixins)
+	if stale == state.NeedsReapply {
+		return stale, nil
+	}
+	state.NeedsReapply = stale
+	return stale, writeApplyState(state)
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Delusoire/bespoke-cli/v3/cmd/vars"
+	"github.com/Delusoire/bespoke-cli/v3/patch"
+)
+
+func mixin(t *testing.T, module string, rule patch.Rule) compiledMixin {
+	t.Helper()
+	if rule.Files == nil {
+		rule.Files = []string{"*.js"}
+	}
+	compiled, err := rule.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return compiledMixin{module: module, owner: module + ":" + rule.Name, rule: compiled}
+}
+
+func TestGroupMixins(t *testing.T) {
+	previous := vars.Spas
+	vars.Spas = []vars.Spa{
+		{Name: "xpui", Patches: []string{"hooks", "mixins", "user"}},
+		{Name: "login", Patches: []string{"user"}},
+	}
+	t.Cleanup(func() { vars.Spas = previous })
+
+	xpui := mixin(t, "a/m@1.0.0", patch.Rule{Name: "xpui", Find: "a"})
+	groups, err := groupMixins([]compiledMixin{xpui, mixin(t, "b/m@1.0.0", patch.Rule{Name: "explicit", Spa: "xpui", Find: "b"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || len(groups["xpui"]) != 2 {
+		t.Fatalf("groupMixins() = %v", groups)
+	}
+
+	for _, spa := range []string{"login", "missing"} {
+		m := mixin(t, "a/m@1.0.0", patch.Rule{Name: spa, Spa: spa, Find: "a"})
+		_, err := groupMixins([]compiledMixin{xpui, m})
+		if err == nil || !strings.Contains(err.Error(), "a/m@1.0.0:"+spa) || !strings.Contains(err.Error(), "isn't configured for mixins") {
+			t.Errorf("groupMixins() of a mixin targeting %s = %v", spa, err)
+		}
+	}
+}
+
+func TestMixinsPatch(t *testing.T) {
+	one := 1
+	for _, tt := range []struct {
+		name     string
+		mixins   []patch.Rule
+		content  string
+		want     string
+		conflict string
+		check    bool
+	}{
+		{
+			name:    "disjoint edits",
+			mixins:  []patch.Rule{{Name: "r1", Find: "foo", Replace: "FOO"}, {Name: "r2", Find: "bar", Replace: "BAR"}},
+			content: "foo bar",
+			want:    "FOO BAR",
+			check:   true,
+		},
+		{
+			name:     "edits of the same region",
+			mixins:   []patch.Rule{{Name: "r1", Find: "foo bar", Replace: "x"}, {Name: "r2", Find: "bar", Replace: "y"}},
+			content:  "foo bar",
+			conflict: "a/m@1.0.0:r1",
+		},
+		{
+			name: "matches against the original content",
+			// r2 would match the text inserted by r1 if mixins were chained
+			mixins:  []patch.Rule{{Name: "r1", Find: "foo", Replace: "bar"}, {Name: "r2", Find: "bar", Replace: "baz", Expect: &one}},
+			content: "foo bar",
+			want:    "bar baz",
+			check:   true,
+		},
+		{
+			name:    "missing match",
+			mixins:  []patch.Rule{{Name: "r1", Find: "foo", Replace: "x"}, {Name: "r2", Find: "missing", Replace: "y"}},
+			content: "foo",
+			want:    "x",
+			check:   false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var mixins []compiledMixin
+			for _, rule := range tt.mixins {
+				mixins = append(mixins, mixin(t, "a/m@1.0.0", rule))
+			}
+			p := mixinsPatch(mixins)
+			if !p.Match("xpui.js") || p.Match("xpui.css") {
+				t.Fatal("mixins patch selects files its mixins don't")
+			}
+
+			got, _, err := p.Patch("xpui.js", tt.content)
+			if tt.conflict != "" {
+				if !errors.Is(err, patch.ErrConflict) || !strings.Contains(err.Error(), tt.conflict) {
+					t.Fatalf("Patch() = %v, want a conflict of %s", err, tt.conflict)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Patch() = %q, %v, want %q", got, err, tt.want)
+			}
+			if err := p.Check(0); (err == nil) != tt.check {
+				t.Fatalf("Check() = %v, want passing %t", err, tt.check)
+			}
+			if err := p.Check(0); err == nil {
+				t.Fatal("Check() kept the matches of the previous run")
+			}
+		})
+	}
+}
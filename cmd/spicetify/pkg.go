@@ -6,7 +6,13 @@
 package spicetify
 
 import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
 	"github.com/Delusoire/bespoke-cli/v3/module"
+	"github.com/charmbracelet/log"
 
 	"github.com/spf13/cobra"
 )
@@ -16,22 +22,82 @@ var pkgCmd = &cobra.Command{
 	Short: "Manage modules",
 }
 
+var pkgInstallId string
+
 var pkgInstallCmd = &cobra.Command{
-	Use:   "install id url",
-	Short: "Add and Install module",
-	Args:  cobra.ExactArgs(2),
+	Use:   "install url-or-path...",
+	Short: "Add and Install modules",
+	Long:  "Add and Install modules, their identifiers are derived from the metadata of each artifact",
+	Args:  cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		id := args[0]
-		url := args[1]
-		identifier := module.NewStoreIdentifier(id)
-		aurl := module.ArtifactURL(url).Parse().ToUrl()
-		if err := addAndInstall(aurl, identifier); err != nil {
-			rootLogger.Fatal(err)
+		if pkgInstallId != "" && len(args) > 1 {
+			rootLogger.Fatal("--id can only be used when installing a single artifact")
+		}
+
+		var expected *module.StoreIdentifier
+		if pkgInstallId != "" {
+			identifier, err := module.ParseStoreIdentifier(pkgInstallId)
+			if err != nil {
+				rootLogger.Fatal(err)
+			}
+			expected = &identifier
+		}
+
+		results := installArtifacts(args, expected)
+
+		failed := 0
+		for _, result := range results {
+			if result.err != nil {
+				failed++
+				rootLogger.Error("Failed to install module", "artifact", result.artifact, "err", result.err)
+			} else {
+				rootLogger.Info("Module added", "id", result.identifier, "artifact", result.artifact)
+			}
+		}
+		if failed > 0 {
+			rootLogger.Fatalf("%d of %d modules failed to install", failed, len(results))
 		}
-		rootLogger.Info("Module added")
 	},
 }
 
+type installResult struct {
+	artifact   string
+	identifier module.StoreIdentifier
+	err        error
+}
+
+func installArtifacts(artifacts []string, expected *module.StoreIdentifier) []installResult {
+	results := make([]installResult, len(artifacts))
+
+	var wg sync.WaitGroup
+	for i, artifact := range artifacts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			identifier, err := installArtifact(module.ArtifactURL(artifact), expected)
+			results[i] = installResult{artifact: artifact, identifier: identifier, err: err}
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+func installArtifact(url module.ArtifactURL, expected *module.StoreIdentifier) (module.StoreIdentifier, error) {
+	aurl := url.Parse().ToUrl()
+
+	identifier, _, err := module.ResolveStoreIdentifier(aurl)
+	if err != nil {
+		return identifier, err
+	}
+
+	if expected != nil && *expected != identifier {
+		return identifier, fmt.Errorf("identifier mismatch: expected %s but artifact metadata declares %s", expected, identifier)
+	}
+
+	return identifier, addAndInstall(aurl, identifier)
+}
+
 func addAndInstall(aurl module.ArtifactURL, identifier module.StoreIdentifier) error {
 	if err := module.AddStoreInVault(identifier, &module.Store{
 		Installed: false,
@@ -48,11 +114,15 @@ var pkgDeleteCmd = &cobra.Command{
 	Short: "Delete and Remove module",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		identifier := module.NewStoreIdentifier(args[0])
+		identifier, err := module.ParseStoreIdentifier(args[0])
+		if err != nil {
+			rootLogger.Fatal(err)
+		}
 		if err := deleteAndRemove(identifier); err != nil {
 			rootLogger.Fatal(err)
 		}
 		rootLogger.Info("Module deleted")
+		warnIfReapplyNeeded(rootLogger)
 	},
 }
 
@@ -69,14 +139,127 @@ var pkgEnableCmd = &cobra.Command{
 	Short: "Enable or Disable module",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		identifier := module.NewStoreIdentifier(args[0])
+		identifier, err := module.ParseStoreIdentifier(args[0])
+		if err != nil {
+			rootLogger.Fatal(err)
+		}
 		if err := module.EnableModuleInVault(identifier); err != nil {
 			rootLogger.Fatal(err)
 		}
 		rootLogger.Info("Module enabled")
+		warnIfReapplyNeeded(rootLogger)
+	},
+}
+
+func warnIfReapplyNeeded(logger *log.Logger) {
+	stale, err := markReapplyIfMixinsChanged()
+	if err != nil {
+		logger.Warnf("failed to check mixins: %s", err)
+	} else if stale {
+		logger.Warn("The enabled mixins changed, run `spicetify apply` to apply them")
+	}
+}
+
+var (
+	pkgNewDir     string
+	pkgNewVersion string
+	pkgNewMixins  bool
+	pkgNewInstall bool
+	pkgNewEnable  bool
+)
+
+var pkgNewCmd = &cobra.Command{
+	Use:   "new author/name",
+	Short: "Scaffold a new module",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		author, name, ok := strings.Cut(args[0], "/")
+		if !ok {
+			rootLogger.Fatal("module must be named author/name")
+		}
+		// name is the default folder of the module, so it's vetted before anything is written
+		if err := module.ValidateComponent("author", author); err != nil {
+			rootLogger.Fatal(err)
+		}
+		if err := module.ValidateComponent("name", name); err != nil {
+			rootLogger.Fatal(err)
+		}
+
+		dir := pkgNewDir
+		if dir == "" {
+			dir = name
+		}
+
+		metadata := module.NewMetadata(author, name, pkgNewVersion, pkgNewMixins)
+		if err := module.Scaffold(dir, metadata); err != nil {
+			rootLogger.Fatal(err)
+		}
+		rootLogger.Info("Module scaffolded", "path", dir)
+
+		if !pkgNewInstall && !pkgNewEnable {
+			return
+		}
+
+		identifier := metadata.GetStoreIdentifier()
+		aurl := module.LocalArtifact(filepath.Clean(dir)).ToUrl()
+		if err := addAndInstall(aurl, identifier); err != nil {
+			rootLogger.Fatal(err)
+		}
+		rootLogger.Info("Module added", "id", identifier)
+
+		if !pkgNewEnable {
+			return
+		}
+		if err := module.EnableModuleInVault(identifier); err != nil {
+			rootLogger.Fatal(err)
+		}
+		rootLogger.Info("Module enabled", "id", identifier)
+		warnIfReapplyNeeded(rootLogger)
+	},
+}
+
+var (
+	pkgReconcileReinstall bool
+	pkgReconcileDryRun    bool
+)
+
+var pkgReconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Reconcile the vault with the filesystem",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		changes, err := module.Reconcile(module.ReconcileOptions{
+			Reinstall: pkgReconcileReinstall,
+			DryRun:    pkgReconcileDryRun,
+		})
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+		if err != nil {
+			rootLogger.Fatal(err)
+		}
+		if len(changes) == 0 {
+			rootLogger.Info("Vault is in sync with the filesystem")
+		} else if pkgReconcileDryRun {
+			rootLogger.Infof("%d changes would be made", len(changes))
+		} else {
+			rootLogger.Infof("Reconciled %d changes", len(changes))
+			warnIfReapplyNeeded(rootLogger)
+		}
 	},
 }
 
 func init() {
-	pkgCmd.AddCommand(pkgInstallCmd, pkgDeleteCmd, pkgEnableCmd)
+	pkgNewCmd.Flags().StringVar(&pkgNewDir, "dir", "", "folder to create the module in (defaults to ./name)")
+	pkgNewCmd.Flags().StringVar(&pkgNewVersion, "version", "0.1.0", "initial version of the module")
+	pkgNewCmd.Flags().BoolVar(&pkgNewMixins, "mixins", false, "include an empty mixins.json and set hasMixins")
+	pkgNewCmd.Flags().BoolVar(&pkgNewInstall, "install", false, "link the module into the store")
+	pkgNewCmd.Flags().BoolVar(&pkgNewEnable, "enable", false, "link the module into the store and enable it")
+
+	pkgReconcileCmd.Flags().BoolVar(&pkgReconcileReinstall, "reinstall", false, "reinstall store content missing from the filesystem")
+	pkgReconcileCmd.Flags().BoolVar(&pkgReconcileDryRun, "dry-run", false, "only print the changes")
+
+	pkgInstallCmd.Flags().StringVar(&pkgInstallId, "id", "", "expected identifier (author/name@version) of the artifact, checked against its metadata")
+
+	pkgCmd.AddCommand(pkgInstallCmd, pkgDeleteCmd, pkgEnableCmd, pkgNewCmd, pkgReconcileCmd)
 }
@@ -0,0 +1,320 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/Delusoire/bespoke-cli/v3/diff"
+	"github.com/Delusoire/bespoke-cli/v3/patch"
+	"github.com/Delusoire/bespoke-cli/v3/paths"
+	"github.com/charmbracelet/log"
+)
+
+type patchResult struct {
+	Matches int `json:"matches"`
+	// Via names the pattern that matched, for patches trying several
+	Via string `json:"via,omitempty"`
+}
+
+type filePatch struct {
+	ID string
+	// Fingerprint is recorded in the apply state, so that editing a patch triggers a re-apply
+	Fingerprint string
+	// Match selects files by their slash separated path inside the spa
+	Match func(name string) bool
+	Patch func(name string, content string) (string, patchResult, error)
+	// Check validates the matches summed over every selected file
+	Check func(total int) error
+}
+
+func rulePatch(rule *patch.Compiled) filePatch {
+	return filePatch{
+		ID:          "user:" + rule.Name,
+		Fingerprint: rule.Fingerprint(),
+		Match:       rule.MatchFile,
+		Patch: func(name string, s string) (string, patchResult, error) {
+			edits := rule.Find(s)
+			patched, err := patch.Apply(s, edits)
+			return patched, patchResult{Matches: len(edits)}, err
+		},
+		Check: rule.Check,
+	}
+}
+
+type snapshotStep struct {
+	SpotifyVersion string `json:"spotifyVersion"`
+	// Spas maps the name of every spa to its pristine source
+	Spas map[string]string `json:"spas"`
+}
+
+type extractStep struct {
+	Src   string   `json:"src"`
+	Dest  string   `json:"dest"`
+	Files []string `json:"files"`
+}
+
+type renameStep struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type patchStep struct {
+	ID     string      `json:"id"`
+	File   string      `json:"file"`
+	Result patchResult `json:"result"`
+	Diff   string      `json:"diff"`
+	name   string
+	patch  func(string, string) (string, patchResult, error)
+}
+
+type linkStep struct {
+	Link   string `json:"link"`
+	Target string `json:"target"`
+}
+
+type applyMode string
+
+const (
+	// applyModeExtract extracts fresh spa files shipped by Spotify
+	applyModeExtract applyMode = "extract"
+	// applyModeReapply extracts the backups of previously patched spa files
+	applyModeReapply applyMode = "reapply"
+	// applyModeLinks only refreshes the links of an up to date installation
+	applyModeLinks applyMode = "links"
+)
+
+// applyPlan lists every mutation apply performs on the Spotify installation, in order of execution
+type applyPlan struct {
+	Mode     applyMode     `json:"mode"`
+	State    applyState    `json:"state"`
+	Warnings []string      `json:"warnings,omitempty"`
+	Snapshot *snapshotStep `json:"snapshot,omitempty"`
+	Extract  []extractStep `json:"extract"`
+	Renames  []renameStep  `json:"renames"`
+	Patches  []patchStep   `json:"patches"`
+	Links    []linkStep    `json:"links"`
+}
+
+// addSpa plans the extraction and patching of spa, which is either the spa called name or its backup
+func (p *applyPlan) addSpa(name string, spa string, destFolder string, patches []filePatch, backup bool) error {
+	extractDest := filepath.Join(destFolder, name)
+
+	hash, err := hashFile(spa)
+	if err != nil {
+		return err
+	}
+	p.State.Spas[name] = hash
+
+	r, err := zip.OpenReader(spa)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	files := []string{}
+	for _, f := range r.File {
+		if !f.Mode().IsDir() {
+			files = append(files, f.Name)
+		}
+	}
+	p.Extract = append(p.Extract, extractStep{Src: spa, Dest: extractDest, Files: files})
+
+	if backup {
+		p.Renames = append(p.Renames, renameStep{From: spa, To: spa + ".bak"})
+	}
+
+	// patches run in order, each one against the output of the previous ones
+	contents := map[string]string{}
+	read := func(file string) (string, error) {
+		if content, ok := contents[file]; ok {
+			return content, nil
+		}
+		return readZipFile(&r.Reader, file)
+	}
+
+	for _, fp := range patches {
+		total := 0
+		for _, file := range files {
+			if !fp.Match(file) {
+				continue
+			}
+
+			original, err := read(file)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", file, err)
+			}
+			patched, result, err := fp.Patch(file, original)
+			if err != nil {
+				return fmt.Errorf("patch %s failed on %s: %w", fp.ID, file, err)
+			}
+			contents[file] = patched
+			total += result.Matches
+
+			if result.Matches == 0 {
+				continue
+			}
+			p.Patches = append(p.Patches, patchStep{
+				ID:     fp.ID,
+				File:   filepath.Join(extractDest, filepath.FromSlash(file)),
+				Result: result,
+				Diff:   diff.Unified("a/"+name+"/"+file, "b/"+name+"/"+file, original, patched, 3),
+				name:   file,
+				patch:  fp.Patch,
+			})
+		}
+
+		if fp.Check != nil {
+			if err := fp.Check(total); err != nil {
+				return err
+			}
+		}
+
+		id := name + ":" + fp.ID
+		if fp.Fingerprint != "" {
+			id += "@" + fp.Fingerprint
+		}
+		p.State.Patches = append(p.State.Patches, id)
+	}
+
+	return nil
+}
+
+// skipExtraction drops extraction and patching when the previous apply already produced the same result
+func (p *applyPlan) skipExtraction(previous *applyState) bool {
+	if len(p.Renames) > 0 || !p.State.sameAs(previous) {
+		return false
+	}
+	for _, step := range p.Extract {
+		if !paths.EnsurePath(step.Dest) {
+			return false
+		}
+	}
+
+	p.Mode = applyModeLinks
+	p.Snapshot = nil
+	p.Extract = nil
+	p.Patches = nil
+	return true
+}
+
+func readZipFile(r *zip.Reader, name string) (string, error) {
+	f, err := r.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(f)
+	return string(content), err
+}
+
+func (p *applyPlan) execute(logger *log.Logger) error {
+	for _, warning := range p.Warnings {
+		logger.Warn(warning)
+	}
+
+	if p.Snapshot != nil {
+		m, err := snapshots.Create(p.Snapshot.SpotifyVersion, p.Snapshot.Spas)
+		if err != nil {
+			return fmt.Errorf("failed to snapshot the stock spa files: %w", err)
+		}
+		logger.Infof("Snapshot %s of Spotify %s", m.ID, m.SpotifyVersion)
+	}
+
+	for _, step := range p.Extract {
+		if err := extractSpa(step.Src, step.Dest, logger); err != nil {
+			return fmt.Errorf("failed to extract %s: %w", filepath.Base(step.Src), err)
+		}
+	}
+
+	for _, step := range p.Renames {
+		logger.Infof("Moving %s -> %s", step.From, step.To)
+		if err := os.Rename(step.From, step.To); err != nil {
+			return err
+		}
+	}
+
+	for _, step := range p.Patches {
+		logger.Infof("Patching %s", step.File)
+		var result patchResult
+		if err := patchFile(step.File, func(s string) (string, error) {
+			var err error
+			s, result, err = step.patch(step.name, s)
+			return s, err
+		}); err != nil {
+			return fmt.Errorf("failed to patch %s: %w", filepath.Base(step.File), err)
+		}
+		keyvals := []any{"id", step.ID, "matches", result.Matches}
+		if result.Via != "" {
+			keyvals = append(keyvals, "via", result.Via)
+		}
+		logger.Info("Patch applied", keyvals...)
+	}
+
+	for _, step := range p.Links {
+		if err := step.execute(logger); err != nil {
+			return fmt.Errorf("failed to link files: %w", err)
+		}
+	}
+
+	if err := writeApplyState(&p.State); err != nil {
+		return fmt.Errorf("failed to record apply state: %w", err)
+	}
+
+	return nil
+}
+
+func printPlan(w io.Writer, plan *applyPlan, asJson bool) error {
+	if asJson {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(plan)
+	}
+
+	fmt.Fprintf(w, "mode    %s\n", plan.Mode)
+	for _, warning := range plan.Warnings {
+		fmt.Fprintf(w, "warning %s\n", warning)
+	}
+	if plan.Snapshot != nil {
+		names := make([]string, 0, len(plan.Snapshot.Spas))
+		for name := range plan.Snapshot.Spas {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "backup  %s\n", plan.Snapshot.Spas[name])
+		}
+	}
+	for _, step := range plan.Extract {
+		fmt.Fprintf(w, "extract %s -> %s (%d files)\n", step.Src, step.Dest, len(step.Files))
+	}
+	for _, step := range plan.Renames {
+		fmt.Fprintf(w, "rename  %s -> %s\n", step.From, step.To)
+	}
+	for _, step := range plan.Patches {
+		summary := fmt.Sprintf("%s, %d matches", step.ID, step.Result.Matches)
+		if step.Result.Via != "" {
+			summary += " via " + step.Result.Via
+		}
+		if step.Diff == "" {
+			fmt.Fprintf(w, "patch   %s (%s, unchanged)\n", step.File, summary)
+			continue
+		}
+		fmt.Fprintf(w, "patch   %s (%s)\n%s", step.File, summary, step.Diff)
+	}
+	for _, step := range plan.Links {
+		fmt.Fprintf(w, "link    %s -> %s\n", step.Link, step.Target)
+	}
+	return nil
+}
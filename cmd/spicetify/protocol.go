@@ -6,6 +6,8 @@
 package spicetify
 
 import (
+	"errors"
+	"fmt"
 	"net/url"
 	"os/exec"
 	"runtime"
@@ -43,6 +45,7 @@ func HandleProtocol(uri string) (string, error) {
 	arguments := u.Query()
 	err = hp(action, arguments)
 	if err == nil {
+		markReapplyIfMixinsChanged()
 		response += "1"
 	} else {
 		response += "0"
@@ -54,79 +57,164 @@ func HandleProtocol(uri string) (string, error) {
 }
 
 func hp(action string, arguments url.Values) error {
-	switch action {
-	case "add":
-	case "fast-install":
-	case "fast-enable":
-		_artifacts := arguments["artifacts"]
-
-		identifier := module.NewStoreIdentifier(arguments.Get("id"))
-		artifacts := make([]module.ArtifactURL, len(_artifacts))
-		for i, a := range _artifacts {
-			artifacts[i] = module.ArtifactURL(a).Parse().ToUrl()
-		}
-		checksum := arguments.Get("checksum")
-
-		if err := module.AddStoreInVault(identifier, &module.Store{
-			Installed: false,
-			Artifacts: artifacts,
-			Checksum:  checksum,
-		}); err != nil {
-			return err
-		}
+	run, ok := protocolActions[action]
+	if !ok {
+		return e.ErrUnsupportedOperation
+	}
+	_, err := run(protocolParams{
+		ID:        arguments.Get("id"),
+		Artifacts: arguments["artifacts"],
+		Checksum:  arguments.Get("checksum"),
+	})
+	return err
+}
 
-		if action == "add" {
-			return nil
-		}
+// errInvalidParams marks errors caused by the arguments of an action rather than its execution
+var errInvalidParams = errors.New("invalid params")
 
-		if err := module.InstallModule(identifier); err != nil {
-			return err
-		}
+type protocolParams struct {
+	// ID is a store identifier, author/name@version
+	ID        string   `json:"id"`
+	Artifacts []string `json:"artifacts,omitempty"`
+	Checksum  string   `json:"checksum,omitempty"`
+}
 
-		if action == "fast-install" {
-			return nil
-		}
+func (p protocolParams) identifier() (module.StoreIdentifier, error) {
+	identifier, err := module.ParseStoreIdentifier(p.ID)
+	if err != nil {
+		return identifier, fmt.Errorf("%w: %w", errInvalidParams, err)
+	}
+	return identifier, nil
+}
 
-		return module.EnableModuleInVault(identifier)
+type protocolResult struct {
+	ID string `json:"id"`
+	// Metadata is the metadata of the installed module, for actions which install it
+	Metadata *module.Metadata `json:"metadata,omitempty"`
+}
 
-	case "install":
-		identifier := module.NewStoreIdentifier(arguments.Get("id"))
-		return module.InstallModule(identifier)
+type protocolAction func(p protocolParams) (*protocolResult, error)
+
+// protocolActions are shared by the legacy protocol URIs and the JSON-RPC methods of the daemon
+var protocolActions = map[string]protocolAction{
+	"add":          addAction,
+	"fast-install": fastInstallAction,
+	"fast-enable":  fastEnableAction,
+	"install":      installAction,
+	"enable":       enableAction,
+	"delete":       deleteAction,
+	"remove":       removeAction,
+	"fast-delete":  fastDeleteAction,
+	"fast-remove":  fastRemoveAction,
+}
 
-	case "enable":
-		identifier := module.NewStoreIdentifier(arguments.Get("id"))
-		return module.EnableModuleInVault(identifier)
+func addAction(p protocolParams) (*protocolResult, error) {
+	identifier, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
 
-	case "delete":
-		identifier := module.NewStoreIdentifier(arguments.Get("id"))
-		return module.DeleteModule(identifier)
+	artifacts := make([]module.ArtifactURL, len(p.Artifacts))
+	for i, a := range p.Artifacts {
+		artifacts[i] = module.ArtifactURL(a).Parse().ToUrl()
+	}
 
-	case "remove":
-		identifier := module.NewStoreIdentifier(arguments.Get("id"))
-		return module.RemoveStoreInVault(identifier)
+	if err := module.AddStoreInVault(identifier, &module.Store{
+		Installed: false,
+		Artifacts: artifacts,
+		Checksum:  p.Checksum,
+	}); err != nil {
+		return nil, err
+	}
+	return &protocolResult{ID: identifier.String()}, nil
+}
 
-	case "fast-delete":
-	case "fast-remove":
-		identifier := module.NewStoreIdentifier(arguments.Get("id"))
+func installAction(p protocolParams) (*protocolResult, error) {
+	identifier, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	if err := module.InstallModule(identifier); err != nil {
+		return nil, err
+	}
 
-		if err := module.EnableModuleInVault(module.StoreIdentifier{
-			ModuleIdentifier: identifier.ModuleIdentifier,
-		}); err != nil {
-			return err
-		}
+	metadata, err := module.GetStoredMetadata(identifier)
+	if err != nil {
+		return nil, err
+	}
+	return &protocolResult{ID: identifier.String(), Metadata: &metadata}, nil
+}
 
-		if err := module.DeleteModule(identifier); err != nil {
-			return err
-		}
+func fastInstallAction(p protocolParams) (*protocolResult, error) {
+	if _, err := addAction(p); err != nil {
+		return nil, err
+	}
+	return installAction(p)
+}
 
-		if action == "fast-delete" {
-			return nil
-		}
+func enableAction(p protocolParams) (*protocolResult, error) {
+	identifier, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	if err := module.EnableModuleInVault(identifier); err != nil {
+		return nil, err
+	}
+	return &protocolResult{ID: identifier.String()}, nil
+}
 
-		return module.RemoveStoreInVault(identifier)
+func fastEnableAction(p protocolParams) (*protocolResult, error) {
+	result, err := fastInstallAction(p)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := enableAction(p); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func deleteAction(p protocolParams) (*protocolResult, error) {
+	identifier, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	if err := module.DeleteModule(identifier); err != nil {
+		return nil, err
+	}
+	return &protocolResult{ID: identifier.String()}, nil
+}
+
+func removeAction(p protocolParams) (*protocolResult, error) {
+	identifier, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	if err := module.RemoveStoreInVault(identifier); err != nil {
+		return nil, err
+	}
+	return &protocolResult{ID: identifier.String()}, nil
+}
+
+// fastDeleteAction disables the module before deleting the version
+func fastDeleteAction(p protocolParams) (*protocolResult, error) {
+	identifier, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	if err := module.EnableModuleInVault(module.StoreIdentifier{
+		ModuleIdentifier: identifier.ModuleIdentifier,
+	}); err != nil {
+		return nil, err
+	}
+	return deleteAction(p)
+}
 
+func fastRemoveAction(p protocolParams) (*protocolResult, error) {
+	if _, err := fastDeleteAction(p); err != nil {
+		return nil, err
 	}
-	return e.ErrUnsupportedOperation
+	return removeAction(p)
 }
 
 func open(url string) error {
@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"net/http"
+
+	"github.com/Delusoire/bespoke-cli/v3/registry"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	registryAddr  string
+	registryDir   string
+	registryForce bool
+)
+
+var registryCmd = &cobra.Command{
+	Use:   "registry",
+	Short: "Host a local module registry",
+}
+
+var registryServeCmd = &cobra.Command{
+	Use:   "serve dir",
+	Short: "Serve a folder of module zips over HTTP",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := args[0]
+		index, err := registry.BuildIndex(dir, rootLogger)
+		if err != nil {
+			rootLogger.Fatal(err)
+		}
+		rootLogger.Infof("Indexed %d modules", len(index.Modules))
+
+		rootLogger.Infof("Serving %s on http://%s/%s", dir, registryAddr, registry.IndexFile)
+		if err := http.ListenAndServe(registryAddr, registry.Handler(dir)); err != nil {
+			rootLogger.Fatalf("failed to start server: %s", err)
+		}
+	},
+}
+
+var registryAddCmd = &cobra.Command{
+	Use:   "add zip...",
+	Short: "Add module zips to a registry folder and refresh its index",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, zip := range args {
+			identifier, err := registry.Add(registryDir, zip, registryForce, rootLogger)
+			if err != nil {
+				rootLogger.Fatal(err)
+			}
+			rootLogger.Info("Module added to registry", "id", identifier)
+		}
+	},
+}
+
+func init() {
+	registryServeCmd.Flags().StringVar(&registryAddr, "addr", "localhost:7968", "address to listen on")
+	registryAddCmd.Flags().StringVar(&registryDir, "dir", ".", "registry folder")
+	registryAddCmd.Flags().BoolVar(&registryForce, "force", false, "overwrite versions already in the registry")
+
+	registryCmd.AddCommand(registryServeCmd, registryAddCmd)
+}
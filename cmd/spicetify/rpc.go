@@ -0,0 +1,182 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	e "github.com/Delusoire/bespoke-cli/v3/errors"
+)
+
+// JSON-RPC 2.0 error codes, the ones above -32100 are specific to spicetify
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+	rpcActionFailed   = -32000
+	rpcModuleNotFound = -32001
+)
+
+var errMethodNotFound = errors.New("method not found")
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// rpcNotification is a message from the daemon which expects no answer
+type rpcNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+// rpcSession is the state of the connection requests come from
+type rpcSession struct {
+	// subscribed sessions receive the vault.changed notifications
+	subscribed atomic.Bool
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// isRPCMessage tells JSON-RPC messages from the legacy spicetify: URIs
+func isRPCMessage(message []byte) bool {
+	message = bytes.TrimSpace(message)
+	return len(message) > 0 && (message[0] == '{' || message[0] == '[')
+}
+
+// HandleRPC answers a JSON-RPC 2.0 request or batch, returning nil when there's nothing to answer
+func HandleRPC(message []byte, session *rpcSession) []byte {
+	message = bytes.TrimSpace(message)
+
+	if len(message) > 0 && message[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(message, &batch); err != nil {
+			return marshalRPC(rpcFailure(nil, rpcParseError, err.Error()))
+		}
+		if len(batch) == 0 {
+			return marshalRPC(rpcFailure(nil, rpcInvalidRequest, "empty batch"))
+		}
+
+		responses := []*rpcResponse{}
+		for _, raw := range batch {
+			if res := handleRPCRequest(raw, session); res != nil {
+				responses = append(responses, res)
+			}
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		return marshalRPC(responses)
+	}
+
+	if res := handleRPCRequest(message, session); res != nil {
+		return marshalRPC(res)
+	}
+	return nil
+}
+
+// handleRPCRequest runs a single request, returning nil for notifications
+func handleRPCRequest(raw json.RawMessage, session *rpcSession) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			return rpcFailure(nil, rpcParseError, err.Error())
+		}
+		return rpcFailure(nil, rpcInvalidRequest, err.Error())
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcFailure(req.ID, rpcInvalidRequest, `expected "jsonrpc": "2.0" and a method`)
+	}
+
+	result, err := callRPC(session, req.Method, req.Params)
+	if req.ID == nil {
+		return nil
+	}
+	if err != nil {
+		return rpcFailure(req.ID, rpcCode(err), err.Error())
+	}
+	if result == nil {
+		result = struct{}{}
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+}
+
+func callRPC(session *rpcSession, method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "subscribe":
+		session.subscribed.Store(true)
+		return nil, nil
+	case "unsubscribe":
+		session.subscribed.Store(false)
+		return nil, nil
+	}
+
+	run, ok := protocolActions[method]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errMethodNotFound, method)
+	}
+
+	var p protocolParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidParams, err)
+		}
+	}
+
+	result, err := run(p)
+	if err != nil {
+		return nil, err
+	}
+	markReapplyIfMixinsChanged()
+	return result, nil
+}
+
+func rpcCode(err error) int {
+	switch {
+	case errors.Is(err, errMethodNotFound):
+		return rpcMethodNotFound
+	case errors.Is(err, errInvalidParams):
+		return rpcInvalidParams
+	case errors.Is(err, e.ErrModuleNotFound):
+		return rpcModuleNotFound
+	}
+	return rpcActionFailed
+}
+
+func rpcFailure(id json.RawMessage, code int, message string) *rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: message}}
+}
+
+func marshalRPC(v any) []byte {
+	res, err := json.Marshal(v)
+	if err != nil {
+		res, _ = json.Marshal(rpcFailure(nil, rpcInternalError, err.Error()))
+	}
+	return res
+}
@@ -14,12 +14,16 @@ var rootLogger = vars.RootLogger
 
 func AddCommands(c *cobra.Command) {
 	c.AddCommand(applyCmd)
+	c.AddCommand(backupCmd)
 	c.AddCommand(configCmd)
 	c.AddCommand(daemonCmd)
 	c.AddCommand(devCmd)
+	c.AddCommand(doctorCmd)
 	c.AddCommand(fixCmd)
 	c.AddCommand(initCmd)
 	c.AddCommand(pkgCmd)
 	c.AddCommand(protocolCmd)
+	c.AddCommand(registryCmd)
+	c.AddCommand(statusCmd)
 	c.AddCommand(syncCmd)
 }
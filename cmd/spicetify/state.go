@@ -0,0 +1,156 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/Delusoire/bespoke-cli/v3/paths"
+)
+
+var applyStatePath = filepath.Join(paths.ConfigPath, "apply-state.json")
+
+// applyState records what the last successful apply patched, to tell whether the next one has anything to do
+type applyState struct {
+	SpotifyVersion string `json:"spotifyVersion"`
+	// Spas maps the name of every patched spa to the sha256 of its pristine source
+	Spas         map[string]string `json:"spas"`
+	HooksVersion string            `json:"hooksVersion"`
+	Patches      []string          `json:"patches"`
+	// Mixins lists the modules whose mixins were applied
+	Mixins []string `json:"mixins"`
+	Mirror bool     `json:"mirror"`
+	Dest   string   `json:"dest"`
+	// NeedsReapply is set once the enabled mixins no longer match the applied ones
+	NeedsReapply bool `json:"needsReapply,omitempty"`
+}
+
+func readApplyState() (*applyState, error) {
+	raw, err := os.ReadFile(applyStatePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var state applyState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func writeApplyState(state *applyState) error {
+	content, err := json.MarshalIndent(state, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(applyStatePath, content, 0644)
+}
+
+func removeApplyState() error {
+	err := os.Remove(applyStatePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// autoApplyPausedPath marks spa files restored to their stock state on purpose,
+// the daemon doesn't apply them again on its own until the next apply
+var autoApplyPausedPath = filepath.Join(paths.ConfigPath, "auto-apply-paused")
+
+func pauseAutoApply() error {
+	return os.WriteFile(autoApplyPausedPath, nil, 0644)
+}
+
+func resumeAutoApply() error {
+	err := os.Remove(autoApplyPausedPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func isAutoApplyPaused() bool {
+	_, err := os.Stat(autoApplyPausedPath)
+	return err == nil
+}
+
+// sameAs ignores the Spotify version, which is informative only: the spa hashes already capture updates
+func (s *applyState) sameAs(other *applyState) bool {
+	if other == nil || other.NeedsReapply {
+		return false
+	}
+	if s.HooksVersion != other.HooksVersion || s.Mirror != other.Mirror || s.Dest != other.Dest {
+		return false
+	}
+	if !slices.Equal(s.Patches, other.Patches) || !slices.Equal(s.Mixins, other.Mixins) {
+		return false
+	}
+	if len(s.Spas) != len(other.Spas) {
+		return false
+	}
+	for name, hash := range s.Spas {
+		if other.Spas[name] != hash {
+			return false
+		}
+	}
+	return true
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type hooksPackage struct {
+	Version string `json:"version"`
+	// Engines maps runtimes to the range of versions supported, e.g. {"spotify": ">=1.2.31"}
+	Engines map[string]string `json:"engines"`
+}
+
+func readHooksPackage(hooksPath string) (*hooksPackage, error) {
+	f, err := os.Open(filepath.Join(hooksPath, "package.json"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var pkg hooksPackage
+	if err := json.NewDecoder(f).Decode(&pkg); err != nil {
+		return nil, err
+	}
+	return &pkg, nil
+}
+
+// getHooksVersion prefers the version recorded by sync, which knows the release tag, unless the hooks are a linked checkout
+func getHooksVersion() string {
+	if state, err := readHooksState(); err == nil && state.Current != nil && !state.Current.Linked && state.Current.Version != "" {
+		return state.Current.Version
+	}
+	pkg, err := readHooksPackage(hooksPath)
+	if err != nil {
+		return ""
+	}
+	return pkg.Version
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Delusoire/bespoke-cli/v3/cmd/vars"
+	"github.com/Delusoire/bespoke-cli/v3/paths"
+
+	"github.com/spf13/cobra"
+)
+
+var statusJson bool
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Report the state of the Spotify installation without changing it",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := printStatus(os.Stdout, getStatus(), statusJson); err != nil {
+			rootLogger.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	statusCmd.Flags().BoolVar(&statusJson, "json", false, "print the status as JSON")
+}
+
+const (
+	appsStock    = "stock"
+	appsPatched  = "patched"
+	appsMirrored = "mirrored"
+	appsMissing  = "missing"
+)
+
+const (
+	stateEnabled  = "enabled"
+	stateDisabled = "disabled"
+	stateBlocked  = "blocked"
+	stateUnknown  = "unknown"
+)
+
+type linkStatus struct {
+	Link   string `json:"link"`
+	Target string `json:"target"`
+	Valid  bool   `json:"valid"`
+}
+
+type daemonStatus struct {
+	Addr      string `json:"addr"`
+	Reachable bool   `json:"reachable"`
+	// PID is the process of the running daemon, 0 when another program may be listening on Addr
+	PID int `json:"pid,omitempty"`
+}
+
+type status struct {
+	ConfigPath        string `json:"configPath"`
+	SpotifyDataPath   string `json:"spotifyDataPath"`
+	SpotifyExecPath   string `json:"spotifyExecPath"`
+	SpotifyConfigPath string `json:"spotifyConfigPath"`
+	SpotifyVersion    string `json:"spotifyVersion"`
+	// SpotifyVersionSource tells where the version was found: exec, xpui or prefs
+	SpotifyVersionSource string       `json:"spotifyVersionSource,omitempty"`
+	Mirror               bool         `json:"mirror"`
+	Apps                 string       `json:"apps"`
+	HooksInjected        bool         `json:"hooksInjected"`
+	Links                []linkStatus `json:"links"`
+	HooksVersion         string       `json:"hooksVersion"`
+	// HooksLinkedTo is the checkout the hooks link to, see sync --link
+	HooksLinkedTo string       `json:"hooksLinkedTo,omitempty"`
+	Updates       string       `json:"updates"`
+	AppDeveloper  string       `json:"appDeveloper"`
+	Daemon        daemonStatus `json:"daemon"`
+	NeedsReapply  bool         `json:"needsReapply"`
+}
+
+func getStatus() *status {
+	src, dest := getApps()
+	xpui := filepath.Join(dest, "xpui")
+
+	s := &status{
+		ConfigPath:        paths.ConfigPath,
+		SpotifyDataPath:   vars.SpotifyDataPath,
+		SpotifyExecPath:   vars.SpotifyExecPath,
+		SpotifyConfigPath: vars.SpotifyConfigPath,
+		Mirror:            vars.Mirror,
+		Apps:              getAppsStatus(src, dest),
+		HooksVersion:      getHooksVersion(),
+		Updates:           getUpdatesStatus(),
+		AppDeveloper:      getAppDeveloperStatus(),
+		Daemon:            daemonStatus{Addr: DaemonAddr, Reachable: isDaemonReachable()},
+	}
+	if info, running, _ := readDaemonInfo(); running {
+		s.Daemon.PID = info.PID
+	}
+	s.SpotifyVersion, s.SpotifyVersionSource, _ = paths.DetectSpotifyVersion(vars.SpotifyDataPath, vars.SpotifyExecPath, vars.SpotifyConfigPath)
+
+	if index, err := os.ReadFile(filepath.Join(xpui, "index.html")); err == nil {
+		s.HooksInjected = strings.Contains(string(index), hooksScriptTag)
+	}
+
+	for _, step := range linkFiles(xpui) {
+		s.Links = append(s.Links, linkStatus{Link: step.Link, Target: step.Target, Valid: isLinkValid(step.Link, step.Target)})
+	}
+
+	if state, err := readHooksState(); err == nil && state.Current != nil && state.Current.Linked {
+		s.HooksLinkedTo = state.Current.Source
+	}
+
+	if state, err := readApplyState(); err == nil && state != nil {
+		s.NeedsReapply = state.NeedsReapply
+	}
+
+	return s
+}
+
+func getAppsStatus(src string, dest string) string {
+	if paths.EnsurePath(filepath.Join(dest, "xpui")) {
+		if vars.Mirror {
+			return appsMirrored
+		}
+		return appsPatched
+	}
+	if paths.EnsurePath(filepath.Join(src, "xpui.spa")) {
+		return appsStock
+	}
+	return appsMissing
+}
+
+func isLinkValid(link string, target string) bool {
+	a, err := os.Stat(link)
+	if err != nil {
+		return false
+	}
+	b, err := os.Stat(target)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(a, b)
+}
+
+var updateEndpointRe = regexp.MustCompile(`desktop-update/(v2/update|no/thanks)`)
+
+// getUpdatesStatus reads the update endpoint patched by `spotify update on|off`
+func getUpdatesStatus() string {
+	match, err := paths.ScanFile(vars.SpotifyExecPath, updateEndpointRe)
+	if err != nil || match == nil {
+		return stateUnknown
+	}
+	switch match[1] {
+	case "v2/update":
+		return stateEnabled
+	case "no/thanks":
+		return stateBlocked
+	}
+	return stateUnknown
+}
+
+// getAppDeveloperStatus reads the flags patched by `spicetify dev`
+func getAppDeveloperStatus() string {
+	content, err := os.ReadFile(filepath.Join(vars.SpotifyConfigPath, "offline.bnk"))
+	if err != nil {
+		return stateUnknown
+	}
+	i := strings.Index(string(content), "app-developer")
+	j := strings.LastIndex(string(content), "app-developer")
+	if i == -1 || j+15 >= len(content) {
+		return stateUnknown
+	}
+	if content[i+14] == '2' && content[j+15] == '2' {
+		return stateEnabled
+	}
+	return stateDisabled
+}
+
+func isDaemonReachable() bool {
+	conn, err := net.DialTimeout("tcp", DaemonAddr, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func printStatus(w io.Writer, s *status, asJson bool) error {
+	if asJson {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(s)
+	}
+
+	version := stateUnknown
+	if s.SpotifyVersion != "" {
+		version = fmt.Sprintf("%s (from %s)", s.SpotifyVersion, s.SpotifyVersionSource)
+	}
+	hooksVersion := s.HooksVersion
+	if hooksVersion == "" {
+		hooksVersion = "not installed"
+	}
+	if s.HooksLinkedTo != "" {
+		hooksVersion += " (linked to " + s.HooksLinkedTo + ")"
+	}
+	daemon := "unreachable"
+	if s.Daemon.Reachable {
+		daemon = "reachable"
+	}
+	if s.Daemon.PID != 0 {
+		daemon += fmt.Sprintf(" (pid %d)", s.Daemon.PID)
+	}
+
+	fmt.Fprintf(w, "config path          %s\n", s.ConfigPath)
+	fmt.Fprintf(w, "Spotify data path    %s\n", s.SpotifyDataPath)
+	fmt.Fprintf(w, "Spotify exec path    %s\n", s.SpotifyExecPath)
+	fmt.Fprintf(w, "Spotify config path  %s\n", s.SpotifyConfigPath)
+	fmt.Fprintf(w, "Spotify version      %s\n", version)
+	fmt.Fprintf(w, "apps                 %s\n", s.Apps)
+	fmt.Fprintf(w, "hooks injected       %t\n", s.HooksInjected)
+	for _, l := range s.Links {
+		valid := "broken"
+		if l.Valid {
+			valid = "valid"
+		}
+		fmt.Fprintf(w, "link %-15s %s (%s)\n", filepath.Base(l.Link), valid, l.Target)
+	}
+	fmt.Fprintf(w, "hooks version        %s\n", hooksVersion)
+	fmt.Fprintf(w, "updates              %s\n", s.Updates)
+	fmt.Fprintf(w, "app-developer        %s\n", s.AppDeveloper)
+	fmt.Fprintf(w, "daemon               %s on %s\n", daemon, s.Daemon.Addr)
+	fmt.Fprintf(w, "needs reapply        %t\n", s.NeedsReapply)
+	return nil
+}
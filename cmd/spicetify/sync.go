@@ -6,38 +6,336 @@
 package spicetify
 
 import (
-	"net/http"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/Delusoire/bespoke-cli/v3/archive"
+	"github.com/Delusoire/bespoke-cli/v3/hooks"
+	"github.com/Delusoire/bespoke-cli/v3/link"
+	"github.com/Delusoire/bespoke-cli/v3/network"
 	"github.com/Delusoire/bespoke-cli/v3/paths"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	syncForce    bool
+	syncVersion  string
+	syncChannel  string
+	syncFrom     string
+	syncRollback bool
+	syncLink     string
+	syncInsecure bool
 )
 
 var syncCmd = &cobra.Command{
 	Use:   "sync",
-	Short: "Update spicetify hooks from GitHub",
+	Short: "Install or update spicetify hooks",
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := installHooks(); err != nil {
+		var (
+			record *hooksRecord
+			err    error
+		)
+		switch {
+		case syncRollback:
+			record, err = rollbackHooks()
+		case syncLink != "":
+			record, err = linkHooks(syncLink)
+		case syncFrom != "":
+			record, err = installHooksFromFile(syncFrom)
+		default:
+			record, err = installHooksRelease(syncVersion, getHooksChannel(), syncInsecure)
+		}
+		if err != nil {
 			rootLogger.Fatal(err)
 		}
-		rootLogger.Info("Hooks updated successfully")
+		rootLogger.Info("Hooks updated successfully", "version", record.Version)
 	},
 }
 
-// TODO: let the user choose which release to install (& include version compatibility info)
-func installHooks() error {
-	res, err := http.Get("http://github.com/spicetify/hooks/releases/latest/download/hooks.tar.gz")
+func init() {
+	syncCmd.Flags().BoolVar(&syncForce, "force", false, "install hooks which don't support the installed Spotify version")
+	syncCmd.Flags().StringVar(&syncVersion, "version", "", "release tag to install instead of the newest release")
+	syncCmd.Flags().StringVar(&syncChannel, "channel", "", "release channel, stable or prerelease (default hooks.channel or stable)")
+	syncCmd.Flags().StringVar(&syncFrom, "from", "", "install a local hooks.tar.gz, or the one inside a folder")
+	syncCmd.Flags().BoolVar(&syncRollback, "rollback", false, "return to the previously installed hooks")
+	syncCmd.Flags().StringVar(&syncLink, "link", "", "link the hooks to a local checkout, for hooks development")
+	syncCmd.Flags().BoolVar(&syncInsecure, "insecure", false, "install a release which publishes no checksum")
+	syncCmd.MarkFlagsMutuallyExclusive("version", "channel", "from", "rollback", "link")
+	syncCmd.MarkFlagsMutuallyExclusive("insecure", "from", "rollback", "link")
+}
+
+var (
+	hooksPath         = filepath.Join(paths.ConfigPath, "hooks")
+	previousHooksPath = filepath.Join(paths.ConfigPath, "hooks.previous")
+	hooksStatePath    = filepath.Join(paths.ConfigPath, "hooks.json")
+)
+
+type hooksRecord struct {
+	Version     string    `json:"version"`
+	Source      string    `json:"source"`
+	Checksum    string    `json:"checksum,omitempty"`
+	InstalledAt time.Time `json:"installedAt"`
+	// Linked hooks are a link to the checkout at Source
+	Linked bool `json:"linked,omitempty"`
+}
+
+// hooksState records the installed hooks along with the ones kept for rollback
+type hooksState struct {
+	Current  *hooksRecord `json:"current"`
+	Previous *hooksRecord `json:"previous,omitempty"`
+}
+
+func readHooksState() (*hooksState, error) {
+	raw, err := os.ReadFile(hooksStatePath)
 	if err != nil {
-		return err
+		if os.IsNotExist(err) {
+			return &hooksState{}, nil
+		}
+		return nil, err
 	}
-	defer res.Body.Close()
 
-	hooksPath := filepath.Join(paths.ConfigPath, "hooks")
-	if err := os.RemoveAll(hooksPath); err != nil {
+	var state hooksState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func writeHooksState(state *hooksState) error {
+	content, err := json.MarshalIndent(state, "", "\t")
+	if err != nil {
 		return err
 	}
-	return archive.UnTarGZ(res.Body, hooksPath)
+	return os.WriteFile(hooksStatePath, content, 0644)
+}
+
+func getHooksRepository() hooks.Repository {
+	url := viper.GetString("hooks.url")
+	if url == "" {
+		url = hooks.DefaultURL
+	}
+	return hooks.Repository{URL: url, Client: network.Client}
+}
+
+func getHooksChannel() string {
+	if syncChannel != "" {
+		return syncChannel
+	}
+	if channel := viper.GetString("hooks.channel"); channel != "" {
+		return channel
+	}
+	return hooks.ChannelStable
+}
+
+// installHooksRelease refuses releases without a checksum unless insecure
+func installHooksRelease(tag string, channel string, insecure bool) (*hooksRecord, error) {
+	repository := getHooksRepository()
+	release, err := repository.Find(tag, channel)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum, err := repository.Checksum(release)
+	if err != nil {
+		if !errors.Is(err, hooks.ErrNoChecksum) {
+			return nil, err
+		}
+		if !insecure {
+			return nil, fmt.Errorf("%w\nuse --insecure to install unverified hooks anyway", err)
+		}
+		rootLogger.Warn("Installing unverified hooks", "err", err)
+	}
+
+	tmp, err := os.CreateTemp("", "hooks-*.tar.gz")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	rootLogger.Info("Downloading hooks", "version", release.Tag)
+	if _, err := repository.Download(release, checksum, tmp); err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return installHooks(tmp, hooksRecord{Version: release.Tag, Source: repository.URL, Checksum: checksum})
+}
+
+// installHooksFromFile installs a local tarball, verified against its .sha256 sidecar when there is one
+func installHooksFromFile(from string) (*hooksRecord, error) {
+	if fi, err := os.Stat(from); err != nil {
+		return nil, err
+	} else if fi.IsDir() {
+		from = filepath.Join(from, hooks.AssetName)
+	}
+
+	checksum := ""
+	if f, err := os.Open(from + ".sha256"); err == nil {
+		checksum, err = hooks.ParseChecksum(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.Open(from)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sum, err := hooks.Copy(io.Discard, f, checksum)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	source, _ := filepath.Abs(from)
+	return installHooks(f, hooksRecord{Source: source, Checksum: sum})
+}
+
+// installHooks extracts the tarball r over the hooks, keeping the ones it replaces for rollback
+func installHooks(r io.Reader, record hooksRecord) (*hooksRecord, error) {
+	state, err := readHooksState()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hooks state: %w", err)
+	}
+
+	previous, keep := state.keepCurrent()
+	if err := archive.StageKeep(hooksPath, keep, func(tmp string) error {
+		if err := archive.UnTarGZ(r, tmp); err != nil {
+			return err
+		}
+		if record.Version == "" {
+			if pkg, err := readHooksPackage(tmp); err == nil {
+				record.Version = pkg.Version
+			}
+		}
+		return checkHooksCompatibility(tmp)
+	}); err != nil {
+		return nil, err
+	}
+
+	record.InstalledAt = time.Now().UTC()
+	state.Current, state.Previous = &record, previous
+	if err := writeHooksState(state); err != nil {
+		return nil, fmt.Errorf("failed to record hooks state: %w", err)
+	}
+	return &record, nil
+}
+
+// keepCurrent tells what the hooks kept for rollback become once the installed ones get replaced.
+// Links to a checkout are dropped rather than kept, and without installed hooks the kept ones stay untouched
+func (s *hooksState) keepCurrent() (*hooksRecord, string) {
+	if s.Current != nil && s.Current.Linked {
+		return s.Previous, ""
+	}
+	if !paths.EnsurePath(hooksPath) {
+		return s.Previous, previousHooksPath
+	}
+	if s.Current == nil {
+		return &hooksRecord{Version: getHooksVersion()}, previousHooksPath
+	}
+	return s.Current, previousHooksPath
+}
+
+// linkHooks replaces the hooks with a link to the checkout, so that its changes apply without a sync
+func linkHooks(checkout string) (*hooksRecord, error) {
+	target, err := filepath.Abs(checkout)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(target); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("%s isn't a folder", target)
+	}
+
+	state, err := readHooksState()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hooks state: %w", err)
+	}
+
+	tmp := hooksPath + ".link"
+	os.Remove(tmp)
+	if err := link.Create(target, tmp); err != nil {
+		return nil, err
+	}
+
+	previous, keep := state.keepCurrent()
+	if err := archive.Swap(tmp, hooksPath, keep); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+
+	record := hooksRecord{Source: target, InstalledAt: time.Now().UTC(), Linked: true}
+	if pkg, err := readHooksPackage(target); err == nil {
+		record.Version = pkg.Version
+	}
+	state.Current, state.Previous = &record, previous
+	if err := writeHooksState(state); err != nil {
+		return nil, fmt.Errorf("failed to record hooks state: %w", err)
+	}
+	return &record, nil
+}
+
+// rollbackHooks exchanges the installed hooks with the previous ones
+func rollbackHooks() (*hooksRecord, error) {
+	if !paths.EnsurePath(previousHooksPath) {
+		return nil, errors.New("no previous hooks to roll back to")
+	}
+
+	state, err := readHooksState()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hooks state: %w", err)
+	}
+
+	if err := archive.Swap(previousHooksPath, hooksPath, previousHooksPath); err != nil {
+		return nil, err
+	}
+
+	state.Current, state.Previous = state.Previous, state.Current
+	if state.Current == nil {
+		state.Current = &hooksRecord{}
+	}
+	if pkg, err := readHooksPackage(hooksPath); err == nil && state.Current.Version == "" {
+		state.Current.Version = pkg.Version
+	}
+	if err := writeHooksState(state); err != nil {
+		return nil, fmt.Errorf("failed to record hooks state: %w", err)
+	}
+	return state.Current, nil
+}
+
+// checkHooksCompatibility refuses the hooks extracted at hooksPath unless they support the installed Spotify
+func checkHooksCompatibility(hooksPath string) error {
+	pkg, err := readHooksPackage(hooksPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("invalid hooks release: %w", err)
+	}
+
+	err = checkSpotifyCompatibility("hooks "+pkg.Version, pkg.Engines, getSpotifyVersion())
+	if err == nil {
+		return nil
+	}
+	if syncForce {
+		rootLogger.Warn(err)
+		return nil
+	}
+	return fmt.Errorf("%w\nuse --force to install anyway", err)
 }
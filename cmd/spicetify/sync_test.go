@@ -0,0 +1,189 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package spicetify
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Delusoire/bespoke-cli/v3/hooks"
+	"github.com/spf13/viper"
+)
+
+// useTestHooks starts and ends the test without hooks installed
+func useTestHooks(t *testing.T) {
+	t.Helper()
+	clean := func() {
+		for _, path := range []string{hooksPath, previousHooksPath, hooksStatePath} {
+			os.RemoveAll(path)
+		}
+	}
+	clean()
+	t.Cleanup(clean)
+}
+
+func writeHooks(t *testing.T, dir string, version string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.js"), []byte("// "+version), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "package.json"), []byte(`{"version":"`+version+`"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func hooksTarball(t *testing.T, version string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string]string{
+		"index.js":     "// " + version,
+		"package.json": `{"version":"` + version + `"}`,
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func installedHooks(t *testing.T, dir string) string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(dir, "index.js"))
+	if err != nil {
+		return ""
+	}
+	return string(content[len("// "):])
+}
+
+func TestKeepCurrent(t *testing.T) {
+	previous := &hooksRecord{Version: "v1.0.0"}
+	for _, tt := range []struct {
+		name      string
+		installed string
+		current   *hooksRecord
+		want      string
+		keep      string
+	}{
+		{"nothing installed", "", nil, "v1.0.0", previousHooksPath},
+		{"recorded", "v2.0.0", &hooksRecord{Version: "v2.0.0"}, "v2.0.0", previousHooksPath},
+		{"unrecorded", "v2.0.0", nil, "v2.0.0", previousHooksPath},
+		{"linked", "v2.0.0", &hooksRecord{Version: "v2.0.0", Linked: true}, "v1.0.0", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestHooks(t)
+			if tt.installed != "" {
+				writeHooks(t, hooksPath, tt.installed)
+			}
+
+			state := &hooksState{Current: tt.current, Previous: previous}
+			got, keep := state.keepCurrent()
+			if got == nil || got.Version != tt.want || keep != tt.keep {
+				t.Fatalf("keepCurrent() = %+v, %q, want %s, %q", got, keep, tt.want, tt.keep)
+			}
+		})
+	}
+}
+
+func TestInstallAndRollbackHooks(t *testing.T) {
+	useTestHooks(t)
+
+	if _, err := rollbackHooks(); err == nil {
+		t.Fatal("rollbackHooks() without previous hooks succeeded")
+	}
+
+	for _, version := range []string{"v1.0.0", "v2.0.0"} {
+		if _, err := installHooks(bytes.NewReader(hooksTarball(t, version)), hooksRecord{Version: version}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := installedHooks(t, hooksPath); got != "v2.0.0" {
+		t.Fatalf("installed hooks %q, want v2.0.0", got)
+	}
+	if got := installedHooks(t, previousHooksPath); got != "v1.0.0" {
+		t.Fatalf("previous hooks %q, want v1.0.0", got)
+	}
+
+	for _, want := range []string{"v1.0.0", "v2.0.0"} {
+		record, err := rollbackHooks()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Version != want || installedHooks(t, hooksPath) != want {
+			t.Fatalf("rolled back to %s with %q installed, want %s", record.Version, installedHooks(t, hooksPath), want)
+		}
+		state, err := readHooksState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state.Previous == nil || state.Previous.Version != installedHooks(t, previousHooksPath) {
+			t.Fatalf("previous hooks recorded as %+v, but %q are kept", state.Previous, installedHooks(t, previousHooksPath))
+		}
+	}
+}
+
+func TestInstallHooksReleaseRequiresChecksum(t *testing.T) {
+	useTestHooks(t)
+
+	tarball := hooksTarball(t, "v1.0.0")
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("GET /releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(hooks.Release{
+			Tag:    "v1.0.0",
+			Assets: []hooks.Asset{{Name: hooks.AssetName, URL: srv.URL + "/" + hooks.AssetName}},
+		})
+	})
+	mux.HandleFunc("GET /"+hooks.AssetName, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tarball)
+	})
+
+	viper.Set("hooks.url", srv.URL)
+	defer viper.Set("hooks.url", nil)
+
+	if _, err := installHooksRelease("", hooks.ChannelStable, false); !errors.Is(err, hooks.ErrNoChecksum) {
+		t.Fatalf("installHooksRelease() = %v, want %v", err, hooks.ErrNoChecksum)
+	}
+	if _, err := os.Stat(hooksPath); !os.IsNotExist(err) {
+		t.Fatalf("unverified hooks installed: %v", err)
+	}
+
+	if fix := checkHooks().Fix; fix == nil {
+		t.Fatal("checkHooks() offers no fix for missing hooks")
+	} else if err := fix(); !errors.Is(err, hooks.ErrNoChecksum) {
+		t.Fatalf("doctor fix = %v, want %v", err, hooks.ErrNoChecksum)
+	}
+
+	record, err := installHooksRelease("", hooks.ChannelStable, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := installedHooks(t, hooksPath); record.Version != "v1.0.0" || got != "v1.0.0" {
+		t.Fatalf("installed %q as %s", got, record.Version)
+	}
+}
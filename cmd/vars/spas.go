@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package vars
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/spf13/viper"
+)
+
+// SpaPatches are the patch sets a spa can opt into
+var SpaPatches = []string{"hooks", "mixins", "user"}
+
+// Spa configures the extraction and patching of one of the spa bundles of Spotify
+type Spa struct {
+	// Name is the name of the bundle without its .spa extension
+	Name    string   `mapstructure:"name"`
+	Patches []string `mapstructure:"patches"`
+}
+
+func (s Spa) Has(patch string) bool {
+	return slices.Contains(s.Patches, patch)
+}
+
+func DefaultSpas() []Spa {
+	return []Spa{{Name: "xpui", Patches: SpaPatches}}
+}
+
+func LoadSpas(v *viper.Viper) ([]Spa, error) {
+	if !v.IsSet("spas") {
+		return DefaultSpas(), nil
+	}
+
+	var spas []Spa
+	if err := v.UnmarshalKey("spas", &spas); err != nil {
+		return nil, fmt.Errorf("invalid spas config: %w", err)
+	}
+
+	seen := map[string]bool{}
+	for _, spa := range spas {
+		if spa.Name == "" {
+			return nil, errors.New("invalid spas config: spa is missing a name")
+		}
+		if seen[spa.Name] {
+			return nil, fmt.Errorf("invalid spas config: %s is listed twice", spa.Name)
+		}
+		seen[spa.Name] = true
+		for _, patch := range spa.Patches {
+			if !slices.Contains(SpaPatches, patch) {
+				return nil, fmt.Errorf("invalid spas config: unknown patch %s for %s, expected one of %v", patch, spa.Name, SpaPatches)
+			}
+		}
+	}
+	return spas, nil
+}
@@ -17,6 +17,7 @@ var (
 	SpotifyExecPath   string
 	SpotifyConfigPath string
 	CfgFile           string
+	Spas              = DefaultSpas()
 )
 
 var (
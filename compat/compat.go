@@ -0,0 +1,158 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package compat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a dotted numeric version like 1.2.31.1205, missing parts compare as 0
+type Version []int
+
+func ParseVersion(s string) (Version, error) {
+	if s == "" {
+		return nil, fmt.Errorf("invalid version %q", s)
+	}
+	parts := strings.Split(s, ".")
+	v := make(Version, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+func (v Version) Compare(other Version) int {
+	for i := 0; i < max(len(v), len(other)); i++ {
+		a, b := v.part(i), other.part(i)
+		if a != b {
+			if a < b {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func (v Version) part(i int) int {
+	if i < len(v) {
+		return v[i]
+	}
+	return 0
+}
+
+// hasPrefix reports whether v starts with every part of prefix
+func (v Version) hasPrefix(prefix Version) bool {
+	if len(prefix) > len(v) {
+		return false
+	}
+	for i := range prefix {
+		if v[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (v Version) String() string {
+	parts := make([]string, len(v))
+	for i, n := range v {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+type comparator struct {
+	op      string
+	version Version
+}
+
+func (c comparator) matches(v Version) bool {
+	switch c.op {
+	case ">=":
+		return v.Compare(c.version) >= 0
+	case "<=":
+		return v.Compare(c.version) <= 0 || v.hasPrefix(c.version)
+	case ">":
+		return v.Compare(c.version) > 0 && !v.hasPrefix(c.version)
+	case "<":
+		return v.Compare(c.version) < 0
+	default:
+		return v.hasPrefix(c.version)
+	}
+}
+
+// Range is a set of alternatives separated by "||", each one being comparators separated by spaces which must all match.
+// A comparator is a version prefixed by >=, <=, >, < or =, with bare and partial versions matching every version they prefix:
+// ">=1.2.31 <1.2.50 || 1.2.60" matches 1.2.31.1205 and 1.2.60.12, but neither 1.2.50.3 nor 1.2.61
+type Range struct {
+	raw  string
+	sets [][]comparator
+}
+
+func ParseRange(s string) (*Range, error) {
+	r := &Range{raw: strings.TrimSpace(s)}
+	if r.raw == "" || r.raw == "*" {
+		return r, nil
+	}
+
+	for _, alternative := range strings.Split(r.raw, "||") {
+		var set []comparator
+		for _, field := range strings.Fields(alternative) {
+			var c comparator
+			for _, op := range []string{">=", "<=", ">", "<", "="} {
+				if rest, ok := strings.CutPrefix(field, op); ok {
+					c.op, field = op, rest
+					break
+				}
+			}
+			field = strings.TrimSuffix(strings.TrimSuffix(field, ".x"), ".*")
+			version, err := ParseVersion(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid range %q: %w", s, err)
+			}
+			c.version = version
+			set = append(set, c)
+		}
+		if len(set) == 0 {
+			return nil, fmt.Errorf("invalid range %q: empty alternative", s)
+		}
+		r.sets = append(r.sets, set)
+	}
+	return r, nil
+}
+
+func (r *Range) Contains(v Version) bool {
+	if len(r.sets) == 0 {
+		return true
+	}
+	for _, set := range r.sets {
+		matches := true
+		for _, c := range set {
+			if !c.matches(v) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Range) String() string {
+	if r.raw == "" {
+		return "*"
+	}
+	return r.raw
+}
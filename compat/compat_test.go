@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package compat
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	for _, tt := range []struct {
+		s     string
+		valid bool
+	}{
+		{"1", true},
+		{"1.2.31.1205", true},
+		{"0.0.0", true},
+		{"", false},
+		{"1..2", false},
+		{"1.2.", false},
+		{"v1.2", false},
+		{"1.-2", false},
+		{"1.2.x", false},
+		{"1.2.31.1205.g4d59ad7c", false},
+	} {
+		_, err := ParseVersion(tt.s)
+		if (err == nil) != tt.valid {
+			t.Errorf("ParseVersion(%q) = %v, want valid %t", tt.s, err, tt.valid)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2", "1.2.0.0", 0},
+		{"1.2.10", "1.2.9", 1},
+		{"1.2.9", "1.2.10", -1},
+		{"1.3", "1.2.99", 1},
+		{"1.2.31.1205", "1.2.31", 1},
+	} {
+		a, _ := ParseVersion(tt.a)
+		b, _ := ParseVersion(tt.b)
+		if got := a.Compare(b); got != tt.want {
+			t.Errorf("%s.Compare(%s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestRangeContains(t *testing.T) {
+	for _, tt := range []struct {
+		r       string
+		version string
+		want    bool
+	}{
+		// the example of the README
+		{">=1.2.31 <1.2.50 || 1.2.60", "1.2.31.1205", true},
+		{">=1.2.31 <1.2.50 || 1.2.60", "1.2.60.12", true},
+		{">=1.2.31 <1.2.50 || 1.2.60", "1.2.50.3", false},
+		{">=1.2.31 <1.2.50 || 1.2.60", "1.2.61", false},
+		{">=1.2.31 <1.2.50 || 1.2.60", "1.2.30.999", false},
+		{">=1.2.31 <1.2.50 || 1.2.60", "1.2.49.9", true},
+
+		{"", "1.2.3", true},
+		{"*", "1.2.3", true},
+		{"  ", "1.2.3", true},
+
+		// bare and partial versions match every version they prefix
+		{"1.2", "1.2.99.1", true},
+		{"1.2", "1.20", false},
+		{"1.2.x", "1.2.5", true},
+		{"1.2.*", "1.3", false},
+		{"=1.2.31", "1.2.31.1205", true},
+		{"=1.2.31", "1.2.32", false},
+
+		// <= and > treat their partial version as a prefix
+		{"<=1.2.31", "1.2.31.1205", true},
+		{"<=1.2.31", "1.2.32", false},
+		{">1.2.31", "1.2.31.1205", false},
+		{">1.2.31", "1.2.32", true},
+		{"<1.2.31", "1.2.30.9999", true},
+		{"<1.2.31", "1.2.31.0", false},
+		{">=1.2.31", "1.2.31", true},
+
+		{">=1.2 <1.3 || >=2", "2.0.1", true},
+		{">=1.2 <1.3 || >=2", "1.5", false},
+	} {
+		r, err := ParseRange(tt.r)
+		if err != nil {
+			t.Fatalf("ParseRange(%q) = %v", tt.r, err)
+		}
+		v, err := ParseVersion(tt.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Contains(v); got != tt.want {
+			t.Errorf("ParseRange(%q).Contains(%s) = %t, want %t", tt.r, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestParseRangeInvalid(t *testing.T) {
+	for _, r := range []string{
+		">=",
+		">=1.2 ||",
+		"|| 1.2",
+		">=1.2 || || 1.3",
+		"~1.2",
+		"^1.2",
+		"1.2 - 1.3",
+		">=a.b",
+	} {
+		if _, err := ParseRange(r); err == nil {
+			t.Errorf("ParseRange(%q) succeeded, want an error", r)
+		}
+	}
+}
+
+func TestRangeString(t *testing.T) {
+	for _, tt := range []struct{ r, want string }{
+		{"", "*"},
+		{" >=1.2 ", ">=1.2"},
+		{">=1.2 || 1.3", ">=1.2 || 1.3"},
+	} {
+		r, err := ParseRange(tt.r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.String(); got != tt.want {
+			t.Errorf("ParseRange(%q).String() = %q, want %q", tt.r, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package diff
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// sides rebuilds the lines of a and b from ops
+func sides(ops []op) ([]string, []string) {
+	var a, b []string
+	for _, o := range ops {
+		if o.kind != opInsert {
+			a = append(a, o.line)
+		}
+		if o.kind != opDelete {
+			b = append(b, o.line)
+		}
+	}
+	return a, b
+}
+
+func edits(ops []op) int {
+	n := 0
+	for _, o := range ops {
+		if o.kind != opEqual {
+			n++
+		}
+	}
+	return n
+}
+
+// lcs is the length of the longest common subsequence of a and b, by dynamic programming
+func lcs(a []string, b []string) int {
+	row := make([]int, len(b)+1)
+	for i := range a {
+		prev := 0
+		for j := range b {
+			cur := row[j+1]
+			if a[i] == b[j] {
+				row[j+1] = prev + 1
+			} else {
+				row[j+1] = max(row[j+1], row[j])
+			}
+			prev = cur
+		}
+	}
+	return row[len(b)]
+}
+
+func checkOps(t *testing.T, a []string, b []string) []op {
+	t.Helper()
+	ops := diffLines(a, b)
+	gotA, gotB := sides(ops)
+	if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) {
+		t.Fatalf("diffLines(%q, %q) rebuilds %q and %q", a, b, gotA, gotB)
+	}
+	if got, want := edits(ops), len(a)+len(b)-2*lcs(a, b); got != want {
+		t.Fatalf("diffLines(%q, %q) makes %d edits, want %d", a, b, got, want)
+	}
+	return ops
+}
+
+func TestDiffLines(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		a, b  string
+		kinds string
+	}{
+		{"empty", "", "", ""},
+		{"identical", "a\nb\nc\n", "a\nb\nc\n", "   "},
+		{"insert only", "", "a\nb\n", "++"},
+		{"insert in the middle", "a\nc\n", "a\nb\nc\n", " + "},
+		{"delete only", "a\nb\n", "", "--"},
+		{"delete in the middle", "a\nb\nc\n", "a\nc\n", " - "},
+		{"replace", "a\nb\nc\n", "a\nx\nc\n", " -+ "},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := checkOps(t, splitLines(tt.a), splitLines(tt.b))
+			kinds := ""
+			for _, o := range ops {
+				kinds += string(o.kind)
+			}
+			if kinds != tt.kinds {
+				t.Fatalf("diffLines() = %q, want %q", kinds, tt.kinds)
+			}
+		})
+	}
+}
+
+// TestDiffLinesRandom checks that the ops of random inputs rebuild both sides with as few edits as possible
+func TestDiffLinesRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	lines := func() []string {
+		s := make([]string, r.Intn(40))
+		for i := range s {
+			s[i] = string(rune('a'+r.Intn(4))) + "\n"
+		}
+		return s
+	}
+	for range 500 {
+		checkOps(t, lines(), lines())
+	}
+}
+
+func TestUnified(t *testing.T) {
+	if got := Unified("a", "b", "same\n", "same\n", 3); got != "" {
+		t.Fatalf("Unified() of equal content = %q", got)
+	}
+
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\neleven"
+	want := strings.Join([]string{
+		"--- a/f",
+		"+++ b/f",
+		"@@ -2,3 +2,3 @@",
+		" 2",
+		"-3",
+		"+three",
+		" 4",
+		"@@ -10 +10,2 @@",
+		" 10",
+		"+eleven",
+		`\ No newline at end of file`,
+		"",
+	}, "\n")
+	if got := Unified("a/f", "b/f", a, b, 1); got != want {
+		t.Fatalf("Unified() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -9,3 +9,7 @@ import "errors"
 
 var ErrUnsupportedOperation = errors.New("this opperation is not supported")
 var ErrPathNotFound = errors.New("couldn't find path")
+var ErrVersionNotFound = errors.New("couldn't find version")
+var ErrModuleNotFound = errors.New("couldn't find module")
+var ErrInvalidIdentifier = errors.New("invalid identifier")
+var ErrChecksumMismatch = errors.New("checksum mismatch")
@@ -0,0 +1,191 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package hooks
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	AssetName = "hooks.tar.gz"
+	// DefaultURL is the GitHub API of the hooks repository, anything serving the same release endpoints can stand in
+	DefaultURL = "https://api.github.com/repos/spicetify/hooks"
+)
+
+const (
+	ChannelStable     = "stable"
+	ChannelPrerelease = "prerelease"
+)
+
+var (
+	ErrNoChecksum       = errors.New("no checksum published")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrNoRelease        = errors.New("no matching release")
+)
+
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+	// Digest is published by GitHub as sha256:<hex>
+	Digest string `json:"digest"`
+}
+
+type Release struct {
+	Tag        string  `json:"tag_name"`
+	Prerelease bool    `json:"prerelease"`
+	Draft      bool    `json:"draft"`
+	Assets     []Asset `json:"assets"`
+}
+
+func (r *Release) Asset(name string) *Asset {
+	for i := range r.Assets {
+		if r.Assets[i].Name == name {
+			return &r.Assets[i]
+		}
+	}
+	return nil
+}
+
+type Repository struct {
+	URL    string
+	Client *http.Client
+}
+
+// Find returns the release tagged tag, or the newest release of channel when tag is empty
+func (r Repository) Find(tag string, channel string) (*Release, error) {
+	if tag != "" {
+		var release Release
+		if err := r.getJSON("releases/tags/"+url.PathEscape(tag), &release); err != nil {
+			return nil, err
+		}
+		return &release, nil
+	}
+
+	switch channel {
+	case "", ChannelStable:
+		var release Release
+		if err := r.getJSON("releases/latest", &release); err != nil {
+			return nil, err
+		}
+		return &release, nil
+	case ChannelPrerelease:
+		var releases []Release
+		if err := r.getJSON("releases", &releases); err != nil {
+			return nil, err
+		}
+		for i := range releases {
+			if !releases[i].Draft {
+				return &releases[i], nil
+			}
+		}
+		return nil, ErrNoRelease
+	default:
+		return nil, fmt.Errorf("unknown channel %s, expected %s or %s", channel, ChannelStable, ChannelPrerelease)
+	}
+}
+
+// Checksum returns the sha256 of the hooks asset, from the GitHub digest or a published <asset>.sha256
+func (r Repository) Checksum(release *Release) (string, error) {
+	asset := release.Asset(AssetName)
+	if asset == nil {
+		return "", fmt.Errorf("release %s has no %s", release.Tag, AssetName)
+	}
+	if sum, ok := strings.CutPrefix(asset.Digest, "sha256:"); ok {
+		return sum, nil
+	}
+
+	sidecar := release.Asset(AssetName + ".sha256")
+	if sidecar == nil {
+		return "", fmt.Errorf("release %s: %w", release.Tag, ErrNoChecksum)
+	}
+	res, err := r.get(sidecar.URL)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	return ParseChecksum(res.Body)
+}
+
+// Download writes the hooks asset of release to w, verifying it against checksum unless empty.
+// w holds unverified content when the checksum doesn't match
+func (r Repository) Download(release *Release, checksum string, w io.Writer) (string, error) {
+	asset := release.Asset(AssetName)
+	if asset == nil {
+		return "", fmt.Errorf("release %s has no %s", release.Tag, AssetName)
+	}
+
+	res, err := r.get(asset.URL)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	return Copy(w, res.Body, checksum)
+}
+
+// Copy copies r to w, verifying the sha256 of the content against checksum unless empty
+func Copy(w io.Writer, r io.Reader, checksum string) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), r); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if checksum != "" && !strings.EqualFold(sum, checksum) {
+		return sum, fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, checksum, sum)
+	}
+	return sum, nil
+}
+
+// ParseChecksum reads the first field of a sha256sum style file
+func ParseChecksum(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", ErrNoChecksum
+	}
+	if _, err := hex.DecodeString(fields[0]); err != nil || len(fields[0]) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid checksum %q", fields[0])
+	}
+	return fields[0], nil
+}
+
+func (r Repository) getJSON(endpoint string, v any) error {
+	res, err := r.get(strings.TrimSuffix(r.URL, "/") + "/" + endpoint)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func (r Repository) get(url string) (*http.Response, error) {
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %s: %s", url, res.Status)
+	}
+	return res, nil
+}
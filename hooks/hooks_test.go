@@ -0,0 +1,242 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package hooks
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const tarball = "hooks tarball"
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRepository serves releases along with the files of their assets
+func newRepository(t *testing.T, releases []Release, files map[string]string) Repository {
+	t.Helper()
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	for i := range releases {
+		for j := range releases[i].Assets {
+			asset := &releases[i].Assets[j]
+			asset.URL = srv.URL + "/files/" + releases[i].Tag + "/" + asset.Name
+		}
+	}
+	writeJSON := func(w http.ResponseWriter, v any) {
+		json.NewEncoder(w).Encode(v)
+	}
+
+	mux.HandleFunc("GET /releases", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, releases)
+	})
+	mux.HandleFunc("GET /releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		for _, release := range releases {
+			if !release.Draft && !release.Prerelease {
+				writeJSON(w, release)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("GET /releases/tags/{tag}", func(w http.ResponseWriter, r *http.Request) {
+		for _, release := range releases {
+			if release.Tag == r.PathValue("tag") {
+				writeJSON(w, release)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("GET /files/{tag}/{name}", func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.PathValue("tag")+"/"+r.PathValue("name")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	})
+
+	return Repository{URL: srv.URL + "/", Client: srv.Client()}
+}
+
+func TestFind(t *testing.T) {
+	repository := newRepository(t, []Release{
+		{Tag: "v3.0.0", Draft: true},
+		{Tag: "v2.1.0-rc", Prerelease: true},
+		{Tag: "v2.0.0"},
+		{Tag: "v1.0.0"},
+	}, nil)
+
+	for _, tt := range []struct {
+		tag, channel string
+		want         string
+		err          bool
+	}{
+		{"", "", "v2.0.0", false},
+		{"", ChannelStable, "v2.0.0", false},
+		{"", ChannelPrerelease, "v2.1.0-rc", false},
+		{"v1.0.0", ChannelPrerelease, "v1.0.0", false},
+		{"v9.9.9", "", "", true},
+		{"", "nightly", "", true},
+	} {
+		release, err := repository.Find(tt.tag, tt.channel)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Find(%q, %q) = %s, want an error", tt.tag, tt.channel, release.Tag)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Find(%q, %q) = %v", tt.tag, tt.channel, err)
+		} else if release.Tag != tt.want {
+			t.Errorf("Find(%q, %q) = %s, want %s", tt.tag, tt.channel, release.Tag, tt.want)
+		}
+	}
+}
+
+func TestFindPrereleaseWithoutReleases(t *testing.T) {
+	repository := newRepository(t, []Release{{Tag: "v1.0.0", Draft: true}}, nil)
+	if _, err := repository.Find("", ChannelPrerelease); !errors.Is(err, ErrNoRelease) {
+		t.Fatalf("Find() = %v, want %v", err, ErrNoRelease)
+	}
+}
+
+func TestAsset(t *testing.T) {
+	release := Release{Assets: []Asset{{Name: AssetName + ".sha256"}, {Name: AssetName}}}
+	if asset := release.Asset(AssetName); asset == nil || asset.Name != AssetName {
+		t.Fatalf("Asset(%s) = %v", AssetName, asset)
+	}
+	if asset := release.Asset("hooks.zip"); asset != nil {
+		t.Fatalf("Asset(hooks.zip) = %v, want nil", asset)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	sum := sha256Hex(tarball)
+	repository := newRepository(t, []Release{
+		{Tag: "digest", Assets: []Asset{{Name: AssetName, Digest: "sha256:" + sum}, {Name: AssetName + ".sha256"}}},
+		{Tag: "sidecar", Assets: []Asset{{Name: AssetName}, {Name: AssetName + ".sha256"}}},
+		{Tag: "bad-sidecar", Assets: []Asset{{Name: AssetName}, {Name: AssetName + ".sha256"}}},
+		{Tag: "none", Assets: []Asset{{Name: AssetName, Digest: "md5:abc"}}},
+		{Tag: "no-asset", Assets: []Asset{{Name: AssetName + ".sha256"}}},
+	}, map[string]string{
+		"sidecar/" + AssetName + ".sha256":     sum + "  " + AssetName + "\n",
+		"bad-sidecar/" + AssetName + ".sha256": "not a checksum\n",
+	})
+
+	for _, tt := range []struct {
+		tag  string
+		want string
+		err  error
+	}{
+		{"digest", sum, nil},
+		{"sidecar", sum, nil},
+		{"none", "", ErrNoChecksum},
+	} {
+		release, err := repository.Find(tt.tag, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := repository.Checksum(release)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("Checksum(%s) = %q, %v, want %q, %v", tt.tag, got, err, tt.want, tt.err)
+		}
+	}
+
+	for _, tag := range []string{"bad-sidecar", "no-asset"} {
+		release, err := repository.Find(tag, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repository.Checksum(release); err == nil || errors.Is(err, ErrNoChecksum) {
+			t.Errorf("Checksum(%s) = %v, want an error other than %v", tag, err, ErrNoChecksum)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	repository := newRepository(t, []Release{{Tag: "v1.0.0", Assets: []Asset{{Name: AssetName}}}}, map[string]string{
+		"v1.0.0/" + AssetName: tarball,
+	})
+	release, err := repository.Find("v1.0.0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if sum, err := repository.Download(release, sha256Hex(tarball), &buf); err != nil || sum != sha256Hex(tarball) {
+		t.Fatalf("Download() = %q, %v", sum, err)
+	}
+	if buf.String() != tarball {
+		t.Fatalf("downloaded %q, want %q", buf.String(), tarball)
+	}
+	if _, err := repository.Download(release, sha256Hex("other"), io.Discard); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Download() with another checksum = %v, want %v", err, ErrChecksumMismatch)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	sum := sha256Hex(tarball)
+	for _, tt := range []struct {
+		name     string
+		checksum string
+		err      error
+	}{
+		{"unverified", "", nil},
+		{"match", sum, nil},
+		{"match ignoring case", strings.ToUpper(sum), nil},
+		{"mismatch", sha256Hex("other"), ErrChecksumMismatch},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			got, err := Copy(&buf, strings.NewReader(tarball), tt.checksum)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Copy() = %v, want %v", err, tt.err)
+			}
+			if got != sum {
+				t.Fatalf("Copy() = %q, want %q", got, sum)
+			}
+			if buf.String() != tarball {
+				t.Fatalf("copied %q", buf.String())
+			}
+		})
+	}
+}
+
+func TestParseChecksum(t *testing.T) {
+	sum := sha256Hex(tarball)
+	for _, tt := range []struct {
+		content string
+		want    string
+		err     bool
+	}{
+		{sum, sum, false},
+		{sum + "  hooks.tar.gz\n", sum, false},
+		{sum + " *hooks.tar.gz\nignored\n", sum, false},
+		{"", "", true},
+		{"\n", "", true},
+		{"zz" + sum[2:], "", true},
+		{sum[:62], "", true},
+	} {
+		got, err := ParseChecksum(strings.NewReader(tt.content))
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseChecksum(%q) = %q, %v", tt.content, got, err)
+		}
+	}
+}
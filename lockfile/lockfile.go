@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package lockfile
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+var ErrLocked = errors.New("locked by another process")
+
+// Lock is an exclusive lock on a file, which the OS releases when its owner dies
+type Lock struct {
+	f *os.File
+}
+
+// probes of Read hold the file for an instant, Acquire only gives up once the lock outlasts them
+const (
+	acquireAttempts = 5
+	acquireDelay    = 20 * time.Millisecond
+)
+
+// Acquire locks path, failing with ErrLocked when another owner holds it, and writes content into it
+func Acquire(path string, content []byte) (*Lock, error) {
+	f, err := lock(path)
+	for attempt := 1; errors.Is(err, ErrLocked) && attempt < acquireAttempts; attempt++ {
+		time.Sleep(acquireDelay)
+		f, err = lock(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.WriteAt(content, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Lock{f: f}, nil
+}
+
+// Release empties the file before unlocking it. The file stays, removing it would let two owners lock different files
+func (l *Lock) Release() error {
+	if err := l.f.Truncate(0); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+// Read returns the content of the lock at path and whether it's held, without keeping anyone from acquiring it.
+// The content of a lock which isn't held is stale
+func Read(path string) ([]byte, bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	held, err := probe(path)
+	if err != nil {
+		return nil, false, err
+	}
+	return content, held, nil
+}
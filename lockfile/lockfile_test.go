@@ -0,0 +1,44 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package lockfile
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestAcquire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+
+	if _, held, err := Read(path); err != nil || held {
+		t.Fatalf("Read() of a missing lock = %t, %v", held, err)
+	}
+
+	lock, err := Acquire(path, []byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Acquire(path, []byte("second")); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Acquire() = %v, want ErrLocked", err)
+	}
+	if content, held, err := Read(path); err != nil || !held || string(content) != "first" {
+		t.Fatalf("Read() = %q, %t, %v", content, held, err)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, held, err := Read(path); err != nil || held {
+		t.Fatalf("Read() of a released lock = %t, %v", held, err)
+	}
+
+	lock, err = Acquire(path, []byte("again"))
+	if err != nil {
+		t.Fatalf("Acquire() after Release() = %v", err)
+	}
+	lock.Release()
+}
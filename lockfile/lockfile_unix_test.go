@@ -0,0 +1,43 @@
+//go:build unix
+
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package lockfile
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestAcquireOutlastsProbe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// hold the shared lock of a probe caught in the middle of Read
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(acquireDelay, func() { f.Close() })
+
+	lock, err := Acquire(path, []byte("owner"))
+	if err != nil {
+		t.Fatalf("Acquire() during a probe = %v", err)
+	}
+	defer lock.Release()
+
+	if held, err := probe(path); err != nil || !held {
+		t.Fatalf("probe() of a held lock = %t, %v", held, err)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package module
+
+import "sort"
+
+type VaultEventKind string
+
+const (
+	VaultAdded     VaultEventKind = "added"
+	VaultInstalled VaultEventKind = "installed"
+	VaultEnabled   VaultEventKind = "enabled"
+	VaultDisabled  VaultEventKind = "disabled"
+	VaultDeleted   VaultEventKind = "deleted"
+	VaultRemoved   VaultEventKind = "removed"
+)
+
+type VaultEvent struct {
+	Kind       VaultEventKind
+	Identifier StoreIdentifier
+}
+
+// DiffVaults lists the events turning old into new, ordered by module identifier then in the order the
+// protocol actions produce them, e.g. added, installed then enabled
+func DiffVaults(old *Vault, new *Vault) []VaultEvent {
+	identifiers := map[ModuleIdentifier]struct{}{}
+	for identifier := range old.Modules {
+		identifiers[identifier] = struct{}{}
+	}
+	for identifier := range new.Modules {
+		identifiers[identifier] = struct{}{}
+	}
+	sorted := make([]ModuleIdentifier, 0, len(identifiers))
+	for identifier := range identifiers {
+		sorted = append(sorted, identifier)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	var events []VaultEvent
+	for _, identifier := range sorted {
+		events = append(events, diffModules(identifier, old.Modules[identifier], new.Modules[identifier])...)
+	}
+	return events
+}
+
+func diffModules(identifier ModuleIdentifier, old Module, new Module) []VaultEvent {
+	var added, installed, enabled, deleted, removed []VaultEvent
+	event := func(kind VaultEventKind, version Version) VaultEvent {
+		return VaultEvent{Kind: kind, Identifier: StoreIdentifier{ModuleIdentifier: identifier, Version: version}}
+	}
+
+	for _, version := range sortedVersions(new.V) {
+		store := new.V[version]
+		oldStore, ok := old.V[version]
+		if !ok {
+			added = append(added, event(VaultAdded, version))
+		}
+		if store.Installed && !oldStore.Installed {
+			installed = append(installed, event(VaultInstalled, version))
+		}
+		if !store.Installed && oldStore.Installed {
+			deleted = append(deleted, event(VaultDeleted, version))
+		}
+	}
+	for _, version := range sortedVersions(old.V) {
+		if _, ok := new.V[version]; !ok {
+			removed = append(removed, event(VaultRemoved, version))
+		}
+	}
+
+	if old.Enabled != new.Enabled {
+		if new.Enabled == "" {
+			enabled = append(enabled, event(VaultDisabled, old.Enabled))
+		} else {
+			enabled = append(enabled, event(VaultEnabled, new.Enabled))
+		}
+	}
+
+	events := append(added, installed...)
+	events = append(events, enabled...)
+	events = append(events, deleted...)
+	return append(events, removed...)
+}
+
+func sortedVersions(stores map[Version]Store) []Version {
+	versions := make([]Version, 0, len(stores))
+	for version := range stores {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+	return versions
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// useTempVault points the modules folder, the store and the vault at a temporary folder holding vault
+func useTempVault(t *testing.T, vault *Vault) {
+	t.Helper()
+	dir := t.TempDir()
+	previousModules, previousStore, previousVault := modulesFolder, storeFolder, vaultPath
+	modulesFolder, storeFolder = filepath.Join(dir, "modules"), filepath.Join(dir, "store")
+	vaultPath = filepath.Join(modulesFolder, "vault.json")
+	t.Cleanup(func() {
+		modulesFolder, storeFolder, vaultPath = previousModules, previousStore, previousVault
+	})
+
+	if err := os.MkdirAll(modulesFolder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetVault(vault); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func event(kind VaultEventKind, identifier string) VaultEvent {
+	si, err := ParseStoreIdentifier(identifier)
+	if err != nil {
+		panic(err)
+	}
+	return VaultEvent{Kind: kind, Identifier: si}
+}
+
+func TestDiffVaults(t *testing.T) {
+	old := &Vault{Modules: map[ModuleIdentifier]Module{
+		"a/kept":    {Enabled: "1.0.0", V: map[Version]Store{"1.0.0": {Installed: true}}},
+		"a/removed": {V: map[Version]Store{"1.0.0": {}}},
+		"a/updated": {Enabled: "1.0.0", V: map[Version]Store{"1.0.0": {Installed: true}}},
+	}}
+	new := &Vault{Modules: map[ModuleIdentifier]Module{
+		"a/added":   {Enabled: "2.0.0", V: map[Version]Store{"2.0.0": {Installed: true}}},
+		"a/kept":    {Enabled: "1.0.0", V: map[Version]Store{"1.0.0": {Installed: true}}},
+		"a/updated": {Enabled: "2.0.0", V: map[Version]Store{"1.0.0": {}, "2.0.0": {Installed: true}}},
+	}}
+
+	want := []VaultEvent{
+		event(VaultAdded, "a/added@2.0.0"),
+		event(VaultInstalled, "a/added@2.0.0"),
+		event(VaultEnabled, "a/added@2.0.0"),
+		event(VaultRemoved, "a/removed@1.0.0"),
+		event(VaultAdded, "a/updated@2.0.0"),
+		event(VaultInstalled, "a/updated@2.0.0"),
+		event(VaultEnabled, "a/updated@2.0.0"),
+		event(VaultDeleted, "a/updated@1.0.0"),
+	}
+	if got := DiffVaults(old, new); !reflect.DeepEqual(got, want) {
+		t.Fatalf("DiffVaults() = %v, want %v", got, want)
+	}
+}
+
+func TestDeleteModuleEvents(t *testing.T) {
+	useTempVault(t, &Vault{Modules: map[ModuleIdentifier]Module{
+		"a/b": {Enabled: "1.0.0", V: map[Version]Store{"1.0.0": {Installed: true}}},
+	}})
+	old, err := GetVault()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	si := StoreIdentifier{ModuleIdentifier: "a/b", Version: "1.0.0"}
+	store, err := si.toPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(store, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteModule(si); err != nil {
+		t.Fatal(err)
+	}
+	new, err := GetVault()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []VaultEvent{
+		event(VaultDisabled, "a/b@1.0.0"),
+		event(VaultDeleted, "a/b@1.0.0"),
+	}
+	if got := DiffVaults(old, new); !reflect.DeepEqual(got, want) {
+		t.Fatalf("DiffVaults() = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(store); !os.IsNotExist(err) {
+		t.Fatalf("store folder still exists: %v", err)
+	}
+}
@@ -5,7 +5,10 @@
 
 package module
 
-import "path"
+import (
+	"errors"
+	"path"
+)
 
 type Metadata struct {
 	Name        string   `json:"name"`
@@ -19,12 +22,33 @@ type Metadata struct {
 	} `json:"entries"`
 	HasMixins    bool              `json:"hasMixins"`
 	Dependencies map[string]string `json:"dependencies"`
+	// Engines maps runtimes to the range of versions supported, e.g. {"spotify": ">=1.2.31"}
+	Engines map[string]string `json:"engines,omitempty"`
 }
 
 func (m *Metadata) getAuthor() string {
 	return m.Authors[0]
 }
 
+func (m *Metadata) Validate() error {
+	if len(m.Authors) == 0 || m.Authors[0] == "" {
+		return errors.New("metadata is missing an author")
+	}
+	if m.Name == "" {
+		return errors.New("metadata is missing a name")
+	}
+	if m.Version == "" {
+		return errors.New("metadata is missing a version")
+	}
+	if err := ValidateComponent("author", m.getAuthor()); err != nil {
+		return err
+	}
+	if err := ValidateComponent("name", m.Name); err != nil {
+		return err
+	}
+	return ValidateComponent("version", m.Version)
+}
+
 // TODO: avoid usage
 func (m *Metadata) GetModuleIdentifier() ModuleIdentifier {
 	return ModuleIdentifier(path.Join(m.getAuthor(), m.Name))
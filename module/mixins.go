@@ -0,0 +1,85 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package module
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/Delusoire/bespoke-cli/v3/patch"
+)
+
+// MixinsFile holds the apply time mixins of modules declaring hasMixins, in the format of patch.File
+const MixinsFile = "mixins.json"
+
+type Mixins struct {
+	Identifier StoreIdentifier
+	Rules      []patch.Rule
+}
+
+type EnabledModule struct {
+	Identifier StoreIdentifier
+	Metadata   Metadata
+}
+
+// GetEnabledModules returns the metadata of every enabled module, ordered by module identifier
+func GetEnabledModules() ([]EnabledModule, error) {
+	vault, err := GetVault()
+	if err != nil {
+		return nil, err
+	}
+
+	identifiers := make([]ModuleIdentifier, 0, len(vault.Modules))
+	for identifier, module := range vault.Modules {
+		if module.Enabled != "" {
+			identifiers = append(identifiers, identifier)
+		}
+	}
+	sort.Slice(identifiers, func(i, j int) bool {
+		return identifiers[i] < identifiers[j]
+	})
+
+	modules := make([]EnabledModule, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		storeIdentifier := StoreIdentifier{ModuleIdentifier: identifier, Version: vault.Modules[identifier].Enabled}
+
+		metadata, err := GetStoredMetadata(storeIdentifier)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read metadata of %s: %w", storeIdentifier.toString(), err)
+		}
+		modules = append(modules, EnabledModule{Identifier: storeIdentifier, Metadata: metadata})
+	}
+
+	return modules, nil
+}
+
+// GetEnabledMixins returns the mixins of every enabled module declaring hasMixins, ordered by module identifier
+func GetEnabledMixins() ([]Mixins, error) {
+	enabled, err := GetEnabledModules()
+	if err != nil {
+		return nil, err
+	}
+
+	var mixins []Mixins
+	for _, module := range enabled {
+		if !module.Metadata.HasMixins {
+			continue
+		}
+
+		p, err := module.Identifier.toPath()
+		if err != nil {
+			return nil, err
+		}
+		rules, err := patch.Load(filepath.Join(p, MixinsFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mixins of %s: %w", module.Identifier.toString(), err)
+		}
+		mixins = append(mixins, Mixins{Identifier: module.Identifier, Rules: rules})
+	}
+
+	return mixins, nil
+}
@@ -7,8 +7,11 @@ package module
 
 import (
 	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
@@ -18,8 +21,11 @@ import (
 
 	"github.com/Delusoire/bespoke-cli/v3/archive"
 	"github.com/Delusoire/bespoke-cli/v3/link"
+	"github.com/Delusoire/bespoke-cli/v3/network"
 	"github.com/Delusoire/bespoke-cli/v3/paths"
 
+	e "github.com/Delusoire/bespoke-cli/v3/errors"
+
 	bufra "github.com/avvmoto/buf-readerat"
 	"github.com/snabb/httpreaderat"
 )
@@ -52,7 +58,7 @@ func (u ArtifactURL) Parse() Artifact {
 func (u RemoteArtifact) GetMetdata() (Metadata, error) {
 	b, found := strings.CutSuffix(string(u), ".zip")
 	if !found {
-		panic("artifact urls must end with .zip")
+		return Metadata{}, errors.New("artifact urls must end with .zip")
 	}
 
 	murl := RemoteMetadataURL(b + ".metadata.json")
@@ -75,7 +81,11 @@ func (u LocalArtifact) GetMetdata() (Metadata, error) {
 }
 
 func (u LocalArtifact) install(storeIdentifier StoreIdentifier, checksum string) error {
-	return ensureSymlink(string(u), storeIdentifier.toPath())
+	dest, err := storeIdentifier.toPath()
+	if err != nil {
+		return err
+	}
+	return ensureSymlink(string(u), dest)
 }
 
 func (u LocalArtifact) ToUrl() ArtifactURL {
@@ -90,7 +100,7 @@ var modulesFolder = filepath.Join(paths.ConfigPath, "modules")
 var storeFolder = filepath.Join(paths.ConfigPath, "store")
 var vaultPath = filepath.Join(modulesFolder, "vault.json")
 
-func parseMetadata(r io.Reader) (Metadata, error) {
+func ParseMetadata(r io.Reader) (Metadata, error) {
 	var metadata Metadata
 	if err := json.NewDecoder(r).Decode(&metadata); err != nil {
 		return Metadata{}, err
@@ -99,13 +109,17 @@ func parseMetadata(r io.Reader) (Metadata, error) {
 }
 
 func fetchRemoteMetadata(murl RemoteMetadataURL) (Metadata, error) {
-	res, err := http.Get(string(murl))
+	res, err := network.Client.Get(string(murl))
 	if err != nil {
 		return Metadata{}, err
 	}
 	defer res.Body.Close()
 
-	return parseMetadata(res.Body)
+	if res.StatusCode != http.StatusOK {
+		return Metadata{}, fmt.Errorf("failed to fetch %s: %s", murl, res.Status)
+	}
+
+	return ParseMetadata(res.Body)
 }
 
 func fetchLocalMetadata(murl LocalMetadataURL) (Metadata, error) {
@@ -115,15 +129,26 @@ func fetchLocalMetadata(murl LocalMetadataURL) (Metadata, error) {
 	}
 	defer file.Close()
 
-	return parseMetadata(file)
+	return ParseMetadata(file)
 }
 
 func downloadModuleToStore(aurl RemoteArtifact, storeIdentifier StoreIdentifier, checksum string) error {
-	req, _ := http.NewRequest("GET", string(aurl), nil)
+	dest, err := storeIdentifier.toPath()
+	if err != nil {
+		return err
+	}
+	if checksum != "" {
+		return downloadVerifiedModuleToStore(aurl, dest, checksum)
+	}
 
-	htrdr, err := httpreaderat.New(nil, req, nil)
+	req, err := http.NewRequest("GET", string(aurl), nil)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	htrdr, err := httpreaderat.New(network.Client, req, nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", aurl, err)
 	}
 	bhtrdr := bufra.NewBufReaderAt(htrdr, 1024*1024)
 
@@ -132,12 +157,68 @@ func downloadModuleToStore(aurl RemoteArtifact, storeIdentifier StoreIdentifier,
 		return err
 	}
 
-	// TODO: verify checksum
-	return archive.UnZip(zrdr, storeIdentifier.toPath())
+	return archive.Stage(dest, func(tmp string) error {
+		return archive.UnZip(zrdr, tmp)
+	})
+}
+
+// downloadVerifiedModuleToStore downloads the whole artifact to verify its sha256 before extracting it,
+// ranged reads would only fetch the parts of the zip being extracted
+func downloadVerifiedModuleToStore(aurl RemoteArtifact, dest string, checksum string) error {
+	f, err := os.CreateTemp("", "module-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	res, err := network.Client.Get(string(aurl))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s: %s", aurl, res.Status)
+	}
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), res.Body)
+	if err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, checksum) {
+		return fmt.Errorf("%w for %s: expected %s, got %s", e.ErrChecksumMismatch, aurl, checksum, sum)
+	}
+
+	zrdr, err := zip.NewReader(f, size)
+	if err != nil {
+		return err
+	}
+
+	return archive.Stage(dest, func(tmp string) error {
+		return archive.UnZip(zrdr, tmp)
+	})
 }
 
 func deleteModuleFromStore(identifier StoreIdentifier) error {
-	return os.RemoveAll(identifier.toPath())
+	p, err := identifier.toPath()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
+}
+
+// ResolveStoreIdentifier derives the identifier of an artifact from its metadata
+func ResolveStoreIdentifier(aurl ArtifactURL) (StoreIdentifier, Metadata, error) {
+	metadata, err := aurl.Parse().GetMetdata()
+	if err != nil {
+		return StoreIdentifier{}, Metadata{}, fmt.Errorf("failed to fetch metadata of %s: %w", aurl, err)
+	}
+	if err := metadata.Validate(); err != nil {
+		return StoreIdentifier{}, Metadata{}, fmt.Errorf("invalid metadata for %s: %w", aurl, err)
+	}
+	return metadata.GetStoreIdentifier(), metadata, nil
 }
 
 func AddStoreInVault(storeIdentifier StoreIdentifier, store *Store) error {
@@ -154,7 +235,7 @@ func InstallModule(storeIdentifier StoreIdentifier) error {
 
 	store, ok := vault.getStore(storeIdentifier)
 	if !ok {
-		return errors.New("Can't find store " + storeIdentifier.toString())
+		return fmt.Errorf("%w: can't find store %s", e.ErrModuleNotFound, storeIdentifier.toString())
 	}
 
 	// TODO: add more options
@@ -164,56 +245,81 @@ func InstallModule(storeIdentifier StoreIdentifier) error {
 		return err
 	}
 
-	store.Installed = true
-	vault.setStore(storeIdentifier, store)
-	return SetVault(vault)
+	return MutateVault(func(vault *Vault) bool {
+		store, ok := vault.getStore(storeIdentifier)
+		if !ok {
+			return false
+		}
+		store.Installed = true
+		return vault.setStore(storeIdentifier, store)
+	})
 }
 
-func EnableModuleInVault(identifier StoreIdentifier) error {
-	vault, err := GetVault()
+// GetStoredMetadata reads the metadata of the module installed in the store
+func GetStoredMetadata(identifier StoreIdentifier) (Metadata, error) {
+	p, err := identifier.toPath()
 	if err != nil {
-		return err
+		return Metadata{}, err
 	}
+	return fetchLocalMetadata(LocalMetadataURL(filepath.Join(p, "metadata.json")))
+}
 
-	module := vault.getModule(identifier.ModuleIdentifier)
-
-	if module.Enabled == identifier.Version {
-		return nil
-	}
+func EnableModuleInVault(identifier StoreIdentifier) error {
+	var unchanged, missing bool
+	if err := MutateVault(func(vault *Vault) bool {
+		module := vault.getModule(identifier.ModuleIdentifier)
 
-	if len(string(identifier.Version)) > 0 {
-		if _, ok := module.V[identifier.Version]; !ok {
-			return errors.New("Can't find matching " + identifier.toString())
+		if module.Enabled == identifier.Version {
+			unchanged = true
+			return false
 		}
-	}
-
-	module.Enabled = identifier.Version
-	vault.setModule(identifier.ModuleIdentifier, module)
 
-	if len(string(identifier.ModuleIdentifier)) > 0 {
-		destroySymlink(identifier.ModuleIdentifier)
-		if len(string(module.Enabled)) > 0 {
-			if err := createSymlink(identifier); err != nil {
-				return err
+		if len(string(identifier.Version)) > 0 {
+			if _, ok := module.V[identifier.Version]; !ok {
+				missing = true
+				return false
 			}
 		}
+
+		module.Enabled = identifier.Version
+		vault.setModule(identifier.ModuleIdentifier, module)
+		return true
+	}); err != nil {
+		switch {
+		case unchanged:
+			return nil
+		case missing:
+			return fmt.Errorf("%w: can't find matching %s", e.ErrModuleNotFound, identifier.toString())
+		}
+		return err
 	}
 
-	return SetVault(vault)
+	if len(string(identifier.ModuleIdentifier)) == 0 {
+		return nil
+	}
+	if err := destroySymlink(identifier.ModuleIdentifier); err != nil {
+		return err
+	}
+	if len(string(identifier.Version)) > 0 {
+		return createSymlink(identifier)
+	}
+	return nil
 }
 
 func DeleteModule(identifier StoreIdentifier) error {
+	disabled := false
 	if err := MutateVault(func(vault *Vault) bool {
 		module := vault.getModule(identifier.ModuleIdentifier)
 
 		if module.Enabled == identifier.Version {
 			module.Enabled = ""
-			destroySymlink(identifier.ModuleIdentifier)
+			disabled = true
 		}
 
 		store, ok := module.V[identifier.Version]
 		if ok {
 			store.Installed = false
+			module.V[identifier.Version] = store
 		}
 
 		vault.setModule(identifier.ModuleIdentifier, module)
@@ -222,6 +328,11 @@ func DeleteModule(identifier StoreIdentifier) error {
 		return err
 	}
 
+	if disabled {
+		if err := destroySymlink(identifier.ModuleIdentifier); err != nil {
+			return err
+		}
+	}
 	return deleteModuleFromStore(identifier)
 }
 
@@ -244,9 +355,25 @@ func ensureSymlink(oldname string, newname string) error {
 }
 
 func createSymlink(identifier StoreIdentifier) error {
-	return ensureSymlink(identifier.toPath(), identifier.ModuleIdentifier.toPath())
+	target, err := identifier.toPath()
+	if err != nil {
+		return err
+	}
+	p, err := identifier.ModuleIdentifier.toPath()
+	if err != nil {
+		return err
+	}
+	return ensureSymlink(target, p)
 }
 
+// destroySymlink removes the link to the enabled version of the module, if any
 func destroySymlink(identifier ModuleIdentifier) error {
-	return os.Remove(identifier.toPath())
+	p, err := identifier.toPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
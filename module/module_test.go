@@ -0,0 +1,162 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package module
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	e "github.com/Delusoire/bespoke-cli/v3/errors"
+)
+
+func TestInstallModuleVerifiesChecksum(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("index.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("export default {}"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	artifact := buf.Bytes()
+	sum := sha256.Sum256(artifact)
+	checksum := hex.EncodeToString(sum[:])
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "m.zip", time.Time{}, bytes.NewReader(artifact))
+	}))
+	defer srv.Close()
+
+	identifier, err := ParseStoreIdentifier("a/m@1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		checksum string
+		err      error
+	}{
+		{"mismatch", hex.EncodeToString(make([]byte, sha256.Size)), e.ErrChecksumMismatch},
+		{"match", checksum, nil},
+		{"unverified", "", nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			useTempVault(t, &Vault{Modules: map[ModuleIdentifier]Module{}})
+			if err := AddStoreInVault(identifier, &Store{Artifacts: []ArtifactURL{ArtifactURL(srv.URL + "/m.zip")}, Checksum: tt.checksum}); err != nil {
+				t.Fatal(err)
+			}
+
+			err := InstallModule(identifier)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("InstallModule() = %v, want %v", err, tt.err)
+			}
+
+			p, err := identifier.toPath()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, statErr := os.Stat(filepath.Join(p, "index.js"))
+			if installed := statErr == nil; installed != (tt.err == nil) {
+				t.Fatalf("module extracted: %t, %v", installed, statErr)
+			}
+
+			vault, err := GetVault()
+			if err != nil {
+				t.Fatal(err)
+			}
+			store, _ := vault.getStore(identifier)
+			if store.Installed != (tt.err == nil) {
+				t.Fatalf("store recorded as installed: %t", store.Installed)
+			}
+		})
+	}
+}
+
+func TestEnableModuleInVault(t *testing.T) {
+	useTempVault(t, &Vault{Modules: map[ModuleIdentifier]Module{
+		"a/b": {V: map[Version]Store{"1.0.0": {Installed: true}, "2.0.0": {Installed: true}}},
+	}})
+	link, err := ModuleIdentifier("a/b").toPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []Version{"1.0.0", "2.0.0"} {
+		identifier := StoreIdentifier{ModuleIdentifier: "a/b", Version: version}
+		store, err := identifier.toPath()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(store, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, version := range []Version{"1.0.0", "2.0.0", "2.0.0", ""} {
+		identifier := StoreIdentifier{ModuleIdentifier: "a/b", Version: version}
+		if err := EnableModuleInVault(identifier); err != nil {
+			t.Fatalf("EnableModuleInVault(%s) = %v", identifier.toString(), err)
+		}
+
+		vault, err := GetVault()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if enabled := vault.Modules["a/b"].Enabled; enabled != version {
+			t.Fatalf("enabled %s, want %s", enabled, version)
+		}
+		if version == "" {
+			if _, err := os.Lstat(link); !os.IsNotExist(err) {
+				t.Fatalf("link of the disabled module remains: %v", err)
+			}
+			continue
+		}
+		store, err := identifier.toPath()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !linksTo(link, store) {
+			t.Fatalf("%s doesn't link to %s", link, store)
+		}
+	}
+
+	missing := StoreIdentifier{ModuleIdentifier: "a/b", Version: "3.0.0"}
+	if err := EnableModuleInVault(missing); !errors.Is(err, e.ErrModuleNotFound) {
+		t.Fatalf("EnableModuleInVault(%s) = %v, want %v", missing.toString(), err, e.ErrModuleNotFound)
+	}
+}
+
+func TestModuleLinkErrorsPropagate(t *testing.T) {
+	useTempVault(t, &Vault{Modules: map[ModuleIdentifier]Module{
+		"a/b": {Enabled: "1.0.0", V: map[Version]Store{"1.0.0": {Installed: true}, "2.0.0": {Installed: true}}},
+	}})
+	// a folder with content stands where the link of the module belongs, which removing the link can't handle
+	link, err := ModuleIdentifier("a/b").toPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(link, "content"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EnableModuleInVault(StoreIdentifier{ModuleIdentifier: "a/b", Version: "2.0.0"}); err == nil {
+		t.Fatal("EnableModuleInVault() succeeded without relinking the module")
+	}
+	if err := DeleteModule(StoreIdentifier{ModuleIdentifier: "a/b", Version: "2.0.0"}); err == nil {
+		t.Fatal("DeleteModule() succeeded without unlinking the module")
+	}
+}
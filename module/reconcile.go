@@ -0,0 +1,230 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package module
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "+"
+	ChangeRemoved  ChangeKind = "-"
+	ChangeModified ChangeKind = "~"
+)
+
+type Change struct {
+	Kind   ChangeKind
+	Target string
+	Detail string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s %s: %s", c.Kind, c.Target, c.Detail)
+}
+
+type ReconcileOptions struct {
+	// Reinstall fetches the content of stores flagged as installed but missing from the filesystem
+	Reinstall bool
+	DryRun    bool
+}
+
+// Reconcile brings the vault's Installed flags, Enabled versions and module symlinks in line with the filesystem
+func Reconcile(opts ReconcileOptions) ([]Change, error) {
+	vaultMu.Lock()
+	defer vaultMu.Unlock()
+
+	vault, err := GetVault()
+	if err != nil {
+		return nil, err
+	}
+
+	r := reconciler{opts: opts}
+
+	for moduleIdentifier, module := range vault.Modules {
+		if err := moduleIdentifier.validate(); err != nil {
+			r.record(ChangeModified, string(moduleIdentifier), fmt.Sprintf("skipped: %s", err))
+			continue
+		}
+
+		for version, store := range module.V {
+			storeIdentifier := StoreIdentifier{ModuleIdentifier: moduleIdentifier, Version: version}
+			if r.reconcileStore(storeIdentifier, &store) {
+				module.V[version] = store
+			}
+		}
+
+		if module.Enabled != "" {
+			store, ok := module.V[module.Enabled]
+			if !ok || !store.Installed {
+				r.record(ChangeRemoved, string(moduleIdentifier), fmt.Sprintf("disabled %s, its store is not installed", module.Enabled))
+				module.Enabled = ""
+			}
+		}
+
+		if err := r.reconcileSymlink(moduleIdentifier, module.Enabled); err != nil {
+			return r.changes, err
+		}
+
+		vault.Modules[moduleIdentifier] = module
+	}
+
+	if err := r.removeStraySymlinks(vault); err != nil {
+		return r.changes, err
+	}
+
+	if len(r.changes) == 0 || opts.DryRun {
+		return r.changes, nil
+	}
+	return r.changes, SetVault(vault)
+}
+
+type reconciler struct {
+	opts    ReconcileOptions
+	changes []Change
+}
+
+func (r *reconciler) record(kind ChangeKind, target string, detail string) {
+	r.changes = append(r.changes, Change{Kind: kind, Target: target, Detail: detail})
+}
+
+func (r *reconciler) do(action func() error) error {
+	if r.opts.DryRun {
+		return nil
+	}
+	return action()
+}
+
+func (r *reconciler) reconcileStore(identifier StoreIdentifier, store *Store) bool {
+	target := identifier.toString()
+	present := storeExists(identifier)
+
+	if present == store.Installed {
+		return false
+	}
+
+	if present {
+		r.record(ChangeModified, target, "marked as installed, its store folder exists")
+		store.Installed = true
+		return true
+	}
+
+	if r.opts.Reinstall && len(store.Artifacts) > 0 {
+		err := r.do(func() error {
+			return store.Artifacts[0].Parse().install(identifier, store.Checksum)
+		})
+		if err == nil {
+			r.record(ChangeAdded, target, "reinstalled missing store content")
+			return false
+		}
+		r.record(ChangeModified, target, fmt.Sprintf("failed to reinstall: %s", err))
+	}
+
+	if p, err := identifier.toPath(); err == nil && isLink(p) {
+		r.do(func() error { return os.Remove(p) })
+		r.record(ChangeRemoved, target, "removed dangling store link")
+	}
+
+	r.record(ChangeModified, target, "marked as not installed, its store folder is missing")
+	store.Installed = false
+	return true
+}
+
+func (r *reconciler) reconcileSymlink(identifier ModuleIdentifier, enabled Version) error {
+	linkPath, err := identifier.toPath()
+	if err != nil {
+		return err
+	}
+	target := filepath.Join("modules", string(identifier))
+
+	if enabled == "" {
+		if isLink(linkPath) {
+			r.record(ChangeRemoved, target, "removed link of disabled module")
+			return r.do(func() error { return destroySymlink(identifier) })
+		}
+		return nil
+	}
+
+	storeIdentifier := StoreIdentifier{ModuleIdentifier: identifier, Version: enabled}
+	storePath, err := storeIdentifier.toPath()
+	if err != nil {
+		return err
+	}
+	if linksTo(linkPath, storePath) {
+		return nil
+	}
+
+	r.record(ChangeAdded, target, fmt.Sprintf("linked to %s", storeIdentifier.toString()))
+	return r.do(func() error { return createSymlink(storeIdentifier) })
+}
+
+func (r *reconciler) removeStraySymlinks(vault *Vault) error {
+	authors, err := os.ReadDir(modulesFolder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, author := range authors {
+		if !author.IsDir() {
+			continue
+		}
+		names, err := os.ReadDir(filepath.Join(modulesFolder, author.Name()))
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			identifier := ModuleIdentifier(author.Name() + "/" + name.Name())
+			if _, ok := vault.Modules[identifier]; ok {
+				continue
+			}
+			if p, err := identifier.toPath(); err != nil || !isLink(p) {
+				continue
+			}
+			r.record(ChangeRemoved, filepath.Join("modules", string(identifier)), "removed link of unknown module")
+			if err := r.do(func() error { return destroySymlink(identifier) }); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func storeExists(identifier StoreIdentifier) bool {
+	p, err := identifier.toPath()
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(p)
+	return err == nil && info.IsDir()
+}
+
+// isLink reports symlinks as well as windows junctions
+func isLink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&(os.ModeSymlink|os.ModeIrregular) != 0
+}
+
+func linksTo(linkPath string, target string) bool {
+	if !isLink(linkPath) {
+		return false
+	}
+	linkInfo, err := os.Stat(linkPath)
+	if err != nil {
+		return false
+	}
+	targetInfo, err := os.Stat(target)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(linkInfo, targetInfo)
+}
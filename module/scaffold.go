@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package module
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const scaffoldJs = `export default async function (mod) {
+	console.log("%[1]s loaded");
+}
+`
+
+const scaffoldCss = `/* styles for %[1]s */
+`
+
+// scaffoldMixins declares apply time mixins, see patch.Rule
+const scaffoldMixins = `{
+	"patches": []
+}
+`
+
+// NewMetadata returns the metadata of a freshly scaffolded module
+func NewMetadata(author string, name string, version string, hasMixins bool) Metadata {
+	metadata := Metadata{
+		Name:         name,
+		Version:      version,
+		Authors:      []string{author},
+		Tags:         []string{},
+		HasMixins:    hasMixins,
+		Dependencies: map[string]string{},
+	}
+	metadata.Entries.Js = "index.js"
+	metadata.Entries.Css = "index.css"
+	return metadata
+}
+
+// Scaffold writes a module skeleton matching metadata to dir, which must be missing or empty
+func Scaffold(dir string, metadata Metadata) error {
+	if err := metadata.Validate(); err != nil {
+		return err
+	}
+
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return errors.New("refusing to scaffold into non-empty folder " + dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	metadataJson, err := json.MarshalIndent(metadata, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	id := metadata.GetModuleIdentifier()
+	files := map[string]string{
+		"metadata.json":      string(metadataJson) + "\n",
+		metadata.Entries.Js:  fmt.Sprintf(scaffoldJs, id),
+		metadata.Entries.Css: fmt.Sprintf(scaffoldCss, id),
+	}
+	if metadata.HasMixins {
+		files[MixinsFile] = scaffoldMixins
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
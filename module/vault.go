@@ -8,9 +8,16 @@ package module
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/Delusoire/bespoke-cli/v3/paths"
+
+	e "github.com/Delusoire/bespoke-cli/v3/errors"
 )
 
 type Store struct {
@@ -24,8 +31,33 @@ type Name string
 type Version string
 type ModuleIdentifier string
 
-func (mi ModuleIdentifier) toPath() string {
-	return filepath.Join(modulesFolder, string(mi))
+// ValidateComponent rejects parts of identifiers which could escape the folder they're joined to,
+// or which ParseStoreIdentifier can't read back
+func ValidateComponent(kind string, component string) error {
+	if component == "" || component == "." || component == ".." ||
+		strings.ContainsAny(component, "/\\@\x00") ||
+		filepath.IsAbs(component) || filepath.VolumeName(component) != "" {
+		return fmt.Errorf("%w: %s %q", e.ErrInvalidIdentifier, kind, component)
+	}
+	return nil
+}
+
+func (mi ModuleIdentifier) validate() error {
+	author, name, ok := strings.Cut(string(mi), "/")
+	if !ok {
+		return fmt.Errorf("%w: module %q, expected author/name", e.ErrInvalidIdentifier, mi)
+	}
+	if err := ValidateComponent("author", author); err != nil {
+		return err
+	}
+	return ValidateComponent("name", name)
+}
+
+func (mi ModuleIdentifier) toPath() (string, error) {
+	if err := mi.validate(); err != nil {
+		return "", err
+	}
+	return paths.Within(modulesFolder, string(mi))
 }
 
 type Module struct {
@@ -95,7 +127,13 @@ func SetVault(vault *Vault) error {
 	return os.WriteFile(vaultPath, vaultJson, 0700)
 }
 
+// vaultMu serializes read-modify-write cycles of the vault within this process
+var vaultMu sync.Mutex
+
 func MutateVault(mutate func(*Vault) bool) error {
+	vaultMu.Lock()
+	defer vaultMu.Unlock()
+
 	vault, err := GetVault()
 	if err != nil {
 		return err
@@ -123,10 +161,37 @@ func NewStoreIdentifier(identifier string) StoreIdentifier {
 	}
 }
 
+// ParseStoreIdentifier reads author/name@version, the version may be empty to designate no version, e.g. to disable a module
+func ParseStoreIdentifier(identifier string) (StoreIdentifier, error) {
+	if !storeIdentifierRe.MatchString(identifier) {
+		return StoreIdentifier{}, errors.New("invalid store identifier " + identifier + ", expected author/name@version")
+	}
+	si := NewStoreIdentifier(identifier)
+	if err := si.ModuleIdentifier.validate(); err != nil {
+		return StoreIdentifier{}, err
+	}
+	if si.Version != "" {
+		if err := ValidateComponent("version", string(si.Version)); err != nil {
+			return StoreIdentifier{}, err
+		}
+	}
+	return si, nil
+}
+
 func (si *StoreIdentifier) toString() string {
 	return string(si.ModuleIdentifier) + "@" + string(si.Version)
 }
 
-func (si *StoreIdentifier) toPath() string {
-	return filepath.Join(storeFolder, string(si.ModuleIdentifier), string(si.Version))
+func (si StoreIdentifier) String() string {
+	return si.toString()
+}
+
+func (si *StoreIdentifier) toPath() (string, error) {
+	if err := si.ModuleIdentifier.validate(); err != nil {
+		return "", err
+	}
+	if err := ValidateComponent("version", string(si.Version)); err != nil {
+		return "", err
+	}
+	return paths.Within(storeFolder, string(si.ModuleIdentifier), string(si.Version))
 }
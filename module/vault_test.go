@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package module
+
+import (
+	"errors"
+	"testing"
+
+	e "github.com/Delusoire/bespoke-cli/v3/errors"
+)
+
+func TestParseStoreIdentifier(t *testing.T) {
+	for _, tt := range []struct {
+		identifier string
+		valid      bool
+	}{
+		{"author/name@1.0.0", true},
+		{"author/name@", true},
+		{"../name@1.0.0", false},
+		{"author/..@1.0.0", false},
+		{"author/../../tmp@1.0.0", false},
+		{"author/name@..", false},
+		{"author/name@1/../..", false},
+		{`author/na\me@1.0.0`, false},
+		{"/abs/name@1.0.0", false},
+		{"author@1.0.0", false},
+		{"/name@1.0.0", false},
+	} {
+		_, err := ParseStoreIdentifier(tt.identifier)
+		if tt.valid && err != nil {
+			t.Errorf("ParseStoreIdentifier(%q) = %v, want no error", tt.identifier, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("ParseStoreIdentifier(%q) succeeded, want an error", tt.identifier)
+		}
+	}
+}
+
+func TestMetadataValidate(t *testing.T) {
+	for _, tt := range []struct {
+		author, name, version string
+	}{
+		{"author", "../../../../tmp/pwned", "1.0.0"},
+		{"author", "name@evil", "1.0.0"},
+		{"..", "name", "1.0.0"},
+		{"/root", "name", "1.0.0"},
+		{"author", "name", "../1.0.0"},
+		{"author", `name\..\..`, "1.0.0"},
+	} {
+		m := Metadata{Authors: []string{tt.author}, Name: tt.name, Version: tt.version}
+		if err := m.Validate(); !errors.Is(err, e.ErrInvalidIdentifier) {
+			t.Errorf("Validate(%q, %q, %q) = %v, want ErrInvalidIdentifier", tt.author, tt.name, tt.version, err)
+		}
+	}
+
+	m := Metadata{Authors: []string{"author"}, Name: "name", Version: "1.0.0"}
+	if err := m.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want no error", err)
+	}
+}
+
+func TestStoreIdentifierToPath(t *testing.T) {
+	si := StoreIdentifier{ModuleIdentifier: "author/..", Version: "1.0.0"}
+	if p, err := si.toPath(); err == nil {
+		t.Errorf("toPath() = %s, want an error", p)
+	}
+	si = StoreIdentifier{ModuleIdentifier: "author/name", Version: ""}
+	if p, err := si.toPath(); err == nil {
+		t.Errorf("toPath() = %s, want an error for an empty version", p)
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package network
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type HostConfig struct {
+	// Host is matched against the request hostname, "*.example.com" matches every subdomain
+	Host    string            `mapstructure:"host"`
+	Token   string            `mapstructure:"token"`
+	Headers map[string]string `mapstructure:"headers"`
+}
+
+type Config struct {
+	ConnectTimeout time.Duration `mapstructure:"connect-timeout"`
+	ReadTimeout    time.Duration `mapstructure:"read-timeout"`
+	Retries        int           `mapstructure:"retries"`
+	RetryBackoff   time.Duration `mapstructure:"retry-backoff"`
+	CABundle       string        `mapstructure:"ca-bundle"`
+	Proxy          string        `mapstructure:"proxy"`
+	Netrc          bool          `mapstructure:"netrc"`
+	NetrcPath      string        `mapstructure:"netrc-path"`
+	Hosts          []HostConfig  `mapstructure:"hosts"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ConnectTimeout: 10 * time.Second,
+		ReadTimeout:    30 * time.Second,
+		Retries:        3,
+		RetryBackoff:   500 * time.Millisecond,
+	}
+}
+
+func (c *Config) hostConfig(hostname string) *HostConfig {
+	hostname = strings.ToLower(hostname)
+	for i := range c.Hosts {
+		pattern := strings.ToLower(c.Hosts[i].Host)
+		if pattern == hostname {
+			return &c.Hosts[i]
+		}
+		if strings.HasPrefix(pattern, "*.") {
+			if ok, _ := path.Match(pattern, hostname); ok {
+				return &c.Hosts[i]
+			}
+		}
+	}
+	return nil
+}
+
+func LoadConfig(v *viper.Viper) (Config, error) {
+	config := DefaultConfig()
+	if err := v.UnmarshalKey("http", &config); err != nil {
+		return config, fmt.Errorf("invalid http config: %w", err)
+	}
+	return config, nil
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+type netrcEntry struct {
+	login    string
+	password string
+}
+
+type netrc struct {
+	machines map[string]netrcEntry
+	fallback *netrcEntry
+}
+
+func defaultNetrcPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc")
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+func readNetrc(path string) (*netrc, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseNetrc(string(raw)), nil
+}
+
+func parseNetrc(content string) *netrc {
+	n := &netrc{machines: map[string]netrcEntry{}}
+
+	var (
+		machine string
+		entry   *netrcEntry
+	)
+	flush := func() {
+		if entry == nil {
+			return
+		}
+		if machine == "" {
+			n.fallback = entry
+		} else {
+			n.machines[strings.ToLower(machine)] = *entry
+		}
+		entry = nil
+	}
+
+	tokens := strings.Fields(content)
+	for i := 0; i < len(tokens); i++ {
+		next := func() string {
+			if i+1 < len(tokens) {
+				i++
+				return tokens[i]
+			}
+			return ""
+		}
+
+		switch tokens[i] {
+		case "machine":
+			flush()
+			machine = next()
+			entry = &netrcEntry{}
+		case "default":
+			flush()
+			machine = ""
+			entry = &netrcEntry{}
+		case "login":
+			if entry != nil {
+				entry.login = next()
+			}
+		case "password":
+			if entry != nil {
+				entry.password = next()
+			}
+		case "account":
+			next()
+		case "macdef":
+			// macros span until the next blank line, which Fields can't see; stop parsing
+			flush()
+			return n
+		}
+	}
+	flush()
+
+	return n
+}
+
+// lookup returns the login of hostname, falling back to the default login when allowed
+func (n *netrc) lookup(hostname string, fallback bool) (netrcEntry, bool) {
+	if entry, ok := n.machines[strings.ToLower(hostname)]; ok {
+		return entry, true
+	}
+	if fallback && n.fallback != nil {
+		return *n.fallback, true
+	}
+	return netrcEntry{}, false
+}
@@ -0,0 +1,377 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+type state struct {
+	config      Config
+	base        *http.Transport
+	netrc       *netrc
+	credentials bool
+}
+
+type transport struct {
+	state   atomic.Pointer[state]
+	options TransportOptions
+}
+
+// Control vets every connection once its address is resolved, see net.Dialer.Control
+type Control func(network, address string, c syscall.RawConn) error
+
+type TransportOptions struct {
+	// Control vets direct connections, connections to the configured proxy aren't as the proxy resolves destinations itself.
+	// Transports with a Control ignore the proxy of the environment. Errors of Control are final and never retried
+	Control Control
+	// Credentials adds the tokens and headers of the configured hosts and the netrc logins to requests,
+	// only transports whose destinations are chosen by spicetify itself should set it
+	Credentials bool
+}
+
+var defaultTransport = &transport{options: TransportOptions{Credentials: true}}
+
+var (
+	transportsMu sync.Mutex
+	transports   = []*transport{defaultTransport}
+)
+
+// Transport is shared by every subsystem performing network requests, its configuration can be swapped at any time with Configure
+var Transport http.RoundTripper = defaultTransport
+
+var Client = &http.Client{Transport: Transport}
+
+func init() {
+	s, err := newState(DefaultConfig(), defaultTransport.options)
+	if err != nil {
+		panic(err)
+	}
+	defaultTransport.state.Store(s)
+}
+
+func Configure(config Config) error {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+
+	states := make([]*state, len(transports))
+	for i, t := range transports {
+		s, err := newState(config, t.options)
+		if err != nil {
+			return err
+		}
+		states[i] = s
+	}
+	for i, t := range transports {
+		if old := t.state.Swap(states[i]); old != nil {
+			old.base.CloseIdleConnections()
+		}
+	}
+	return nil
+}
+
+// NewTransport returns a transport following the configuration of Transport, with its own options
+func NewTransport(options TransportOptions) (http.RoundTripper, error) {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+
+	t := &transport{options: options}
+	s, err := newState(defaultTransport.state.Load().config, options)
+	if err != nil {
+		return nil, err
+	}
+	t.state.Store(s)
+	transports = append(transports, t)
+	return t, nil
+}
+
+type refusedError struct {
+	err error
+}
+
+func (e refusedError) Error() string { return e.err.Error() }
+
+func (e refusedError) Unwrap() error { return e.err }
+
+func newState(config Config, options TransportOptions) (*state, error) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+
+	dialer := &net.Dialer{
+		Timeout:   config.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	if options.Control != nil {
+		// the proxy of the environment would go unnoticed by Control, only the configured one is trusted
+		base.Proxy = nil
+	}
+	if options.Control != nil && config.Proxy == "" {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			if err := options.Control(network, address, c); err != nil {
+				return refusedError{err}
+			}
+			return nil
+		}
+	}
+	base.DialContext = dialer.DialContext
+	base.TLSHandshakeTimeout = config.ConnectTimeout
+	base.ResponseHeaderTimeout = config.ReadTimeout
+
+	if config.Proxy != "" {
+		proxyUrl, err := url.Parse(config.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url %s: %w", config.Proxy, err)
+		}
+		base.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	if config.CABundle != "" {
+		pool, err := loadCABundle(config.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		base.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	s := &state{config: config, base: base, credentials: options.Credentials}
+
+	if config.Netrc && options.Credentials {
+		netrcPath := config.NetrcPath
+		if netrcPath == "" {
+			netrcPath = defaultNetrcPath()
+		}
+		n, err := readNetrc(netrcPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read netrc %s: %w", netrcPath, err)
+		}
+		s.netrc = n
+	}
+
+	return s, nil
+}
+
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s := t.state.Load()
+
+	ctx, cancel := context.WithCancel(req.Context())
+	req = req.Clone(ctx)
+	if s.credentials {
+		s.authorize(req)
+	}
+
+	attempts := 1
+	if isRetryable(req) {
+		attempts += max(s.config.Retries, 0)
+	}
+
+	var (
+		res *http.Response
+		err error
+	)
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err = rewindBody(req); err != nil {
+				break
+			}
+			if err = sleep(req, s.backoff(attempt, res)); err != nil {
+				break
+			}
+		}
+
+		res, err = s.base.RoundTrip(req)
+		if !shouldRetry(req, res, err) || attempt == attempts-1 {
+			break
+		}
+		if res != nil {
+			res.Body.Close()
+		}
+	}
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// the body of an upgraded connection is an io.ReadWriteCloser outliving any read timeout, which idleBody would hide
+	if rwc, ok := res.Body.(io.ReadWriteCloser); ok && res.StatusCode == http.StatusSwitchingProtocols {
+		res.Body = &upgradedBody{ReadWriteCloser: rwc, cancel: cancel}
+		return res, nil
+	}
+	res.Body = newIdleBody(res.Body, s.config.ReadTimeout, cancel)
+	return res, nil
+}
+
+type upgradedBody struct {
+	io.ReadWriteCloser
+	cancel context.CancelFunc
+}
+
+func (b *upgradedBody) Close() error {
+	err := b.ReadWriteCloser.Close()
+	b.cancel()
+	return err
+}
+
+// ErrReadTimeout is returned by response bodies which stall for longer than the read timeout
+var ErrReadTimeout = errors.New("response body read timed out")
+
+// idleBody cancels its request when a single read waits for longer than timeout,
+// ResponseHeaderTimeout only covers the time until the headers arrive
+type idleBody struct {
+	io.ReadCloser
+	timeout  time.Duration
+	cancel   context.CancelFunc
+	timer    *time.Timer
+	timedOut atomic.Bool
+}
+
+func newIdleBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *idleBody {
+	b := &idleBody{ReadCloser: body, timeout: timeout, cancel: cancel}
+	if timeout > 0 {
+		b.timer = time.AfterFunc(timeout, func() {
+			b.timedOut.Store(true)
+			cancel()
+		})
+		b.timer.Stop()
+	}
+	return b
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	if b.timer == nil {
+		return b.ReadCloser.Read(p)
+	}
+
+	b.timer.Reset(b.timeout)
+	n, err := b.ReadCloser.Read(p)
+	b.timer.Stop()
+	if err != nil && err != io.EOF && b.timedOut.Load() {
+		return n, fmt.Errorf("%w after %s", ErrReadTimeout, b.timeout)
+	}
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func (s *state) authorize(req *http.Request) {
+	hostname := req.URL.Hostname()
+
+	host := s.config.hostConfig(hostname)
+	if host != nil {
+		for k, v := range host.Headers {
+			if req.Header.Get(k) == "" {
+				req.Header.Set(k, v)
+			}
+		}
+		if host.Token != "" && req.Header.Get("Authorization") == "" {
+			req.Header.Set("Authorization", "Bearer "+host.Token)
+		}
+	}
+
+	if s.netrc != nil && req.Header.Get("Authorization") == "" {
+		// the default login only goes to the configured hosts, not to whichever host a module or registry points to
+		if entry, ok := s.netrc.lookup(hostname, host != nil); ok {
+			req.SetBasicAuth(entry.login, entry.password)
+		}
+	}
+}
+
+// maxRetryAfter caps the delays servers ask for, a retry waiting for longer wouldn't be of any use
+const maxRetryAfter = 30 * time.Second
+
+func (s *state) backoff(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			if seconds > int(maxRetryAfter/time.Second) {
+				return maxRetryAfter
+			}
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return s.config.RetryBackoff * (1 << (attempt - 1))
+}
+
+func isRetryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+func shouldRetry(req *http.Request, res *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if err != nil {
+		var refused refusedError
+		return !errors.As(err, &refused)
+	}
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func rewindBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	return nil
+}
+
+func sleep(req *http.Request, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,249 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package network
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newTestTransport(t *testing.T, config Config, options TransportOptions) *transport {
+	t.Helper()
+	s, err := newState(config, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &transport{options: options}
+	tr.state.Store(s)
+	return tr
+}
+
+func TestReadTimeoutCoversBody(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	config := DefaultConfig()
+	config.ReadTimeout = 100 * time.Millisecond
+	client := &http.Client{Transport: newTestTransport(t, config, TransportOptions{})}
+
+	res, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	start := time.Now()
+	_, err = io.ReadAll(res.Body)
+	if !errors.Is(err, ErrReadTimeout) {
+		t.Fatalf("ReadAll() = %v, want ErrReadTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("read timed out after %s", elapsed)
+	}
+}
+
+func TestSlowConsumerDoesNotTimeOut(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.ReadTimeout = 50 * time.Millisecond
+	client := &http.Client{Transport: newTestTransport(t, config, TransportOptions{})}
+
+	res, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	time.Sleep(150 * time.Millisecond)
+	body, err := io.ReadAll(res.Body)
+	if err != nil || string(body) != "body" {
+		t.Fatalf("ReadAll() = %q, %v", body, err)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	config := DefaultConfig()
+	config.Hosts = []HostConfig{{Host: "configured.example", Token: "secret"}}
+
+	for _, tt := range []struct {
+		name        string
+		netrc       string
+		host        string
+		credentials bool
+		want        bool
+	}{
+		{"configured host", "", "configured.example", true, true},
+		{"configured host without credentials", "", "configured.example", false, false},
+		{"netrc machine", "machine " + u.Hostname() + " login user password pass", u.Hostname(), true, true},
+		{"netrc machine without credentials", "machine " + u.Hostname() + " login user password pass", u.Hostname(), false, false},
+		{"netrc default for arbitrary host", "default login user password pass", u.Hostname(), true, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newTestTransport(t, config, TransportOptions{Credentials: tt.credentials})
+			if tt.netrc != "" && tt.credentials {
+				tr.state.Load().netrc = parseNetrc(tt.netrc)
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			req.Host = tt.host
+			req.URL.Host = u.Host
+			if tt.host != u.Hostname() {
+				// route the request to the test server while matching hostConfig against tt.host
+				req.URL.Host = tt.host + ":" + u.Port()
+				tr.state.Load().base.DialContext = nil
+				tr.state.Load().base.Proxy = http.ProxyURL(&url.URL{Scheme: "http", Host: u.Host})
+			}
+
+			res, err := (&http.Client{Transport: tr}).Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if has := got.Get("Authorization") != ""; has != tt.want {
+				t.Fatalf("Authorization sent = %t, want %t", has, tt.want)
+			}
+		})
+	}
+}
+
+func TestControlIgnoresEnvironmentProxy(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "http://127.0.0.1:1")
+	t.Setenv("HTTPS_PROXY", "http://127.0.0.1:1")
+
+	var dialed []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	tr := newTestTransport(t, DefaultConfig(), TransportOptions{Control: func(network, address string, c syscall.RawConn) error {
+		dialed = append(dialed, address)
+		return nil
+	}})
+	if tr.state.Load().base.Proxy != nil {
+		t.Fatal("transport with a control uses the proxy of the environment")
+	}
+
+	res, err := (&http.Client{Transport: tr}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	u, _ := url.Parse(srv.URL)
+	if len(dialed) != 1 || dialed[0] != u.Host {
+		t.Fatalf("dialed %v, want [%s]", dialed, u.Host)
+	}
+}
+
+func TestBackoffClampsRetryAfter(t *testing.T) {
+	config := DefaultConfig()
+	config.RetryBackoff = 100 * time.Millisecond
+	s, err := newState(config, TransportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		retryAfter string
+		attempt    int
+		want       time.Duration
+	}{
+		{"", 1, 100 * time.Millisecond},
+		{"", 3, 400 * time.Millisecond},
+		{"invalid", 2, 200 * time.Millisecond},
+		{"-1", 1, 100 * time.Millisecond},
+		{"0", 3, 0},
+		{"2", 1, 2 * time.Second},
+		{"3600", 1, maxRetryAfter},
+		{"9223372036854775807", 1, maxRetryAfter},
+	} {
+		res := &http.Response{Header: http.Header{}}
+		if tt.retryAfter != "" {
+			res.Header.Set("Retry-After", tt.retryAfter)
+		}
+		if got := s.backoff(tt.attempt, res); got != tt.want {
+			t.Errorf("backoff(%d) with Retry-After %q = %s, want %s", tt.attempt, tt.retryAfter, got, tt.want)
+		}
+	}
+}
+
+func TestUpgradedBodyIsWritable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		rw.Flush()
+		// echo a single line
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		rw.WriteString(line)
+		rw.Flush()
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.ReadTimeout = 50 * time.Millisecond
+	client := &http.Client{Transport: newTestTransport(t, config, TransportOptions{})}
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "echo")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status %d, want %d", res.StatusCode, http.StatusSwitchingProtocols)
+	}
+	rwc, ok := res.Body.(io.ReadWriteCloser)
+	if !ok {
+		t.Fatalf("body of the upgraded connection is a %T, not an io.ReadWriteCloser", res.Body)
+	}
+
+	// idle for longer than the read timeout, which doesn't apply to upgraded connections
+	time.Sleep(2 * config.ReadTimeout)
+	if _, err := rwc.Write([]byte("ping\n")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len("ping\n"))
+	if _, err := io.ReadFull(rwc, buf); err != nil || string(buf) != "ping\n" {
+		t.Fatalf("read %q, %v", buf, err)
+	}
+}
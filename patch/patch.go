@@ -0,0 +1,219 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package patch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrConflict          = errors.New("conflicting edits")
+	ErrUnexpectedMatches = errors.New("unexpected number of matches")
+)
+
+// Edit replaces the bytes [Start, End) of the original content with Text
+type Edit struct {
+	Start int
+	End   int
+	Text  string
+	// Owner names the rule which produced the edit
+	Owner string
+}
+
+type Rule struct {
+	Name string `json:"name"`
+	// Spa names the bundle the rule targets, xpui when empty
+	Spa string `json:"spa,omitempty"`
+	// Files are slash separated globs relative to the root of the spa, "**" matches across folders
+	Files   []string `json:"files"`
+	Find    string   `json:"find"`
+	Replace string   `json:"replace"`
+	Regex   bool     `json:"regex"`
+	// Expect is the number of matches summed over all files, when nil at least one match is required
+	Expect *int `json:"expect,omitempty"`
+}
+
+const DefaultSpa = "xpui"
+
+func (r Rule) TargetSpa() string {
+	if r.Spa == "" {
+		return DefaultSpa
+	}
+	return r.Spa
+}
+
+type File struct {
+	Patches []Rule `json:"patches"`
+}
+
+// Load reads the rules of a patches file, a missing file holds no rules
+func Load(path string) ([]Rule, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var file File
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("invalid patches file %s: %w", path, err)
+	}
+	return file.Patches, nil
+}
+
+type Compiled struct {
+	Rule
+	find  *regexp.Regexp
+	globs []*regexp.Regexp
+}
+
+func (r Rule) Compile() (*Compiled, error) {
+	if r.Name == "" {
+		return nil, errors.New("patch is missing a name")
+	}
+	if r.Find == "" {
+		return nil, fmt.Errorf("patch %s is missing a find pattern", r.Name)
+	}
+	if len(r.Files) == 0 {
+		return nil, fmt.Errorf("patch %s doesn't target any files", r.Name)
+	}
+
+	c := &Compiled{Rule: r}
+
+	if r.Regex {
+		re, err := regexp.Compile(r.Find)
+		if err != nil {
+			return nil, fmt.Errorf("patch %s has an invalid regex: %w", r.Name, err)
+		}
+		c.find = re
+	}
+
+	for _, pattern := range r.Files {
+		glob, err := Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("patch %s has an invalid glob: %w", r.Name, err)
+		}
+		c.globs = append(c.globs, glob)
+	}
+
+	return c, nil
+}
+
+// Fingerprint changes whenever the rule does
+func (c *Compiled) Fingerprint() string {
+	raw, _ := json.Marshal(c.Rule)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:4])
+}
+
+func (c *Compiled) MatchFile(name string) bool {
+	for _, glob := range c.globs {
+		if glob.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the edits of the rule against content
+func (c *Compiled) Find(content string) []Edit {
+	var edits []Edit
+
+	if c.find == nil {
+		for i := 0; ; {
+			j := strings.Index(content[i:], c.Rule.Find)
+			if j == -1 {
+				break
+			}
+			start := i + j
+			end := start + len(c.Rule.Find)
+			edits = append(edits, Edit{Start: start, End: end, Text: c.Replace, Owner: c.Name})
+			i = end
+		}
+		return edits
+	}
+
+	for _, m := range c.find.FindAllStringSubmatchIndex(content, -1) {
+		text := string(c.find.ExpandString(nil, c.Replace, content, m))
+		edits = append(edits, Edit{Start: m[0], End: m[1], Text: text, Owner: c.Name})
+	}
+	return edits
+}
+
+// Check validates the number of matches summed over every file
+func (c *Compiled) Check(total int) error {
+	if c.Expect == nil {
+		if total == 0 {
+			return fmt.Errorf("patch %s: %w: expected at least 1, got 0", c.Name, ErrUnexpectedMatches)
+		}
+		return nil
+	}
+	if total != *c.Expect {
+		return fmt.Errorf("patch %s: %w: expected %d, got %d", c.Name, ErrUnexpectedMatches, *c.Expect, total)
+	}
+	return nil
+}
+
+// Apply performs edits on content, refusing overlapping edits
+func Apply(content string, edits []Edit) (string, error) {
+	sorted := append([]Edit(nil), edits...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	var sb strings.Builder
+	last := 0
+	for i, edit := range sorted {
+		if i > 0 && edit.Start < sorted[i-1].End {
+			prev := sorted[i-1]
+			return "", fmt.Errorf("%w: %s [%d, %d) overlaps %s [%d, %d)", ErrConflict, edit.Owner, edit.Start, edit.End, prev.Owner, prev.Start, prev.End)
+		}
+		sb.WriteString(content[last:edit.Start])
+		sb.WriteString(edit.Text)
+		last = edit.End
+	}
+	sb.WriteString(content[last:])
+
+	return sb.String(), nil
+}
+
+// Glob compiles a slash separated glob where "*" stops at folders and "**" crosses them
+func Glob(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					sb.WriteString("(?:.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package patch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"xpui.js", "xpui.js", true},
+		{"xpui.js", "xpuiXjs", false},
+		{"*.js", "xpui.js", true},
+		{"*.js", "vendor/xpui.js", false},
+		{"*.js", "xpui.css", false},
+		{"**/*.js", "xpui.js", true},
+		{"**/*.js", "vendor/deep/xpui.js", true},
+		{"vendor/**", "vendor/a/b.js", true},
+		{"vendor/**", "other/a.js", false},
+		{"vendor/**/b.js", "vendor/b.js", true},
+		{"vendor/**/b.js", "vendor/a/c/b.js", true},
+		{"?.css", "a.css", true},
+		{"?.css", "ab.css", false},
+		{"?.css", "/.css", false},
+		{"[a].js", "[a].js", true},
+		{"[a].js", "a.js", false},
+	} {
+		glob, err := Glob(tt.pattern)
+		if err != nil {
+			t.Fatalf("Glob(%q) = %v", tt.pattern, err)
+		}
+		if got := glob.MatchString(tt.name); got != tt.want {
+			t.Errorf("Glob(%q) matches %q: %t, want %t", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func compile(t *testing.T, r Rule) *Compiled {
+	t.Helper()
+	c, err := r.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCompile(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		rule Rule
+	}{
+		{"no name", Rule{Find: "a", Files: []string{"*.js"}}},
+		{"no find", Rule{Name: "r", Files: []string{"*.js"}}},
+		{"no files", Rule{Name: "r", Find: "a"}},
+		{"invalid regex", Rule{Name: "r", Find: "(", Regex: true, Files: []string{"*.js"}}},
+	} {
+		if _, err := tt.rule.Compile(); err == nil {
+			t.Errorf("Compile() of a rule with %s succeeded", tt.name)
+		}
+	}
+
+	c := compile(t, Rule{Name: "r", Find: "a", Files: []string{"*.js", "css/*.css"}})
+	for name, want := range map[string]bool{"xpui.js": true, "css/a.css": true, "a.css": false} {
+		if got := c.MatchFile(name); got != want {
+			t.Errorf("MatchFile(%q) = %t, want %t", name, got, want)
+		}
+	}
+	if c.TargetSpa() != DefaultSpa {
+		t.Errorf("TargetSpa() = %s, want %s", c.TargetSpa(), DefaultSpa)
+	}
+	if other := compile(t, Rule{Name: "r", Find: "b", Files: []string{"*.js"}}); other.Fingerprint() == c.Fingerprint() {
+		t.Error("Fingerprint() didn't change along with the rule")
+	}
+}
+
+func TestFind(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		rule    Rule
+		content string
+		want    []Edit
+	}{
+		{
+			"no match",
+			Rule{Find: "x", Replace: "y"},
+			"abc",
+			nil,
+		},
+		{
+			"literal",
+			Rule{Find: "ab", Replace: "X"},
+			"ab-ab",
+			[]Edit{{0, 2, "X", "r"}, {3, 5, "X", "r"}},
+		},
+		{
+			"literal without overlapping matches",
+			Rule{Find: "aa", Replace: "b"},
+			"aaa",
+			[]Edit{{0, 2, "b", "r"}},
+		},
+		{
+			"literal with regex syntax",
+			Rule{Find: "a.b", Replace: "$1"},
+			"axb a.b",
+			[]Edit{{4, 7, "$1", "r"}},
+		},
+		{
+			"regex with groups",
+			Rule{Find: `(\w+)=(\d+)`, Replace: "$2=$1", Regex: true},
+			"a=1;b=22",
+			[]Edit{{0, 3, "1=a", "r"}, {4, 8, "22=b", "r"}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Name, tt.rule.Files = "r", []string{"*"}
+			got := compile(t, tt.rule).Find(tt.content)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Find() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Find() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	zero, two := 0, 2
+	for _, tt := range []struct {
+		expect *int
+		total  int
+		ok     bool
+	}{
+		{nil, 0, false},
+		{nil, 1, true},
+		{nil, 5, true},
+		{&zero, 0, true},
+		{&zero, 1, false},
+		{&two, 2, true},
+		{&two, 1, false},
+		{&two, 3, false},
+	} {
+		c := compile(t, Rule{Name: "r", Find: "a", Files: []string{"*"}, Expect: tt.expect})
+		err := c.Check(tt.total)
+		if (err == nil) != tt.ok || (err != nil && !errors.Is(err, ErrUnexpectedMatches)) {
+			t.Errorf("Check(%d) with expect %v = %v", tt.total, tt.expect, err)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		edits    []Edit
+		want     string
+		conflict bool
+	}{
+		{"no edits", nil, "0123456789", false},
+		{"unsorted", []Edit{{6, 8, "b", "y"}, {1, 3, "a", "x"}}, "0a345b89", false},
+		{"adjacent", []Edit{{0, 2, "a", "x"}, {2, 4, "b", "y"}}, "ab456789", false},
+		{"insertion", []Edit{{5, 5, "+", "x"}}, "01234+56789", false},
+		{"insertions at the same offset", []Edit{{5, 5, "a", "x"}, {5, 5, "b", "y"}}, "01234ab56789", false},
+		{"deletion", []Edit{{0, 10, "", "x"}}, "", false},
+		{"overlap", []Edit{{0, 4, "a", "x"}, {3, 6, "b", "y"}}, "", true},
+		{"containment", []Edit{{0, 9, "a", "x"}, {3, 4, "b", "y"}}, "", true},
+		{"insertion inside a replacement", []Edit{{2, 6, "a", "x"}, {4, 4, "b", "y"}}, "", true},
+		{"same range", []Edit{{2, 4, "a", "x"}, {2, 4, "b", "y"}}, "", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply("0123456789", tt.edits)
+			if tt.conflict {
+				if !errors.Is(err, ErrConflict) {
+					t.Fatalf("Apply() = %q, %v, want %v", got, err, ErrConflict)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Apply() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	if rules, err := Load(filepath.Join(dir, "missing.json")); err != nil || rules != nil {
+		t.Fatalf("Load() of a missing file = %v, %v", rules, err)
+	}
+
+	p := filepath.Join(dir, "patches.json")
+	if err := os.WriteFile(p, []byte(`{"patches": [{"name": "r", "spa": "login", "files": ["*.js"], "find": "a", "expect": 0}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].TargetSpa() != "login" || rules[0].Expect == nil || *rules[0].Expect != 0 {
+		t.Fatalf("Load() = %+v", rules)
+	}
+
+	if err := os.WriteFile(p, []byte(`{"patches": {}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(p); err == nil {
+		t.Fatal("Load() of an invalid file succeeded")
+	}
+}
@@ -6,6 +6,7 @@
 package paths
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -80,6 +81,16 @@ func ResolveHomePaths(relPaths ...string) []string {
 	return paths
 }
 
+// Within joins elem to root, failing when the result lies outside of root
+func Within(root string, elem ...string) (string, error) {
+	p := filepath.Join(append([]string{root}, elem...)...)
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s isn't inside of %s", p, root)
+	}
+	return p, nil
+}
+
 func EnsurePath(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
@@ -0,0 +1,166 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package paths
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	e "github.com/Delusoire/bespoke-cli/v3/errors"
+)
+
+const (
+	VersionSourceExec  = "exec"
+	VersionSourceXpui  = "xpui"
+	VersionSourcePrefs = "prefs"
+)
+
+// spotifyBuildVersionRe matches full Spotify versions, like 1.2.31.1205.g4d59ad7c
+var spotifyBuildVersionRe = regexp.MustCompile(`\b(\d+\.\d+\.\d+\.\d+)\.g[0-9a-f]{7,}\b`)
+
+var spotifyPrefsVersionRe = regexp.MustCompile(`(?m)^app\.last-launched-version="([^"]+)"`)
+
+// DetectSpotifyVersion returns the version of the installed Spotify, without its build hash, along with where it was found.
+// xpui describes the installed files and prefs the version Spotify last launched with,
+// the executable weighs hundreds of MB so it's only scanned when neither tells
+func DetectSpotifyVersion(spotifyDataPath string, spotifyExecPath string, spotifyConfigPath string) (string, string, error) {
+	if version := findXpuiBuildVersion(GetSpotifyAppsPath(spotifyDataPath)); version != "" {
+		return version, VersionSourceXpui, nil
+	}
+	if version, err := GetSpotifyVersion(spotifyConfigPath); err == nil {
+		if match := spotifyBuildVersionRe.FindStringSubmatch(version); match != nil {
+			version = match[1]
+		}
+		return version, VersionSourcePrefs, nil
+	}
+	if version := findBuildVersionInFile(spotifyExecPath); version != "" {
+		return version, VersionSourceExec, nil
+	}
+	return "", "", e.ErrVersionNotFound
+}
+
+// GetSpotifyVersion reads the version Spotify last launched with from its prefs
+func GetSpotifyVersion(spotifyConfigPath string) (string, error) {
+	prefs, err := os.ReadFile(filepath.Join(spotifyConfigPath, "prefs"))
+	if err != nil {
+		return "", err
+	}
+	match := spotifyPrefsVersionRe.FindSubmatch(prefs)
+	if match == nil {
+		return "", e.ErrVersionNotFound
+	}
+	return string(match[1]), nil
+}
+
+const (
+	scanChunk = 1 << 20
+	// scanOverlap is kept from the previous chunk, so that matches up to its length straddling chunks are found
+	scanOverlap = 256
+)
+
+// ScanFile streams file through a window of bounded size, returning the submatches of the first match of re.
+// re must only match fewer than scanOverlap bytes
+func ScanFile(file string, re *regexp.Regexp) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Scan(f, re)
+}
+
+// Scan is ScanFile for any reader
+func Scan(r io.Reader, re *regexp.Regexp) ([]string, error) {
+	window := make([]byte, 0, scanOverlap+scanChunk)
+	overlap := 0
+	for {
+		n, err := io.ReadFull(r, window[len(window):len(window)+scanChunk])
+		window = window[:len(window)+n]
+
+		for _, match := range re.FindAllSubmatchIndex(window, -1) {
+			// the window may start in the middle of a token, whose tail could match on its own
+			if match[0] == 0 && overlap > 0 {
+				continue
+			}
+			submatches := make([]string, len(match)/2)
+			for i := range submatches {
+				if match[2*i] >= 0 {
+					submatches[i] = string(window[match[2*i]:match[2*i+1]])
+				}
+			}
+			return submatches, nil
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		overlap = min(len(window), scanOverlap)
+		window = append(window[:0], window[len(window)-overlap:]...)
+	}
+}
+
+func findBuildVersion(r io.Reader) string {
+	if match, _ := Scan(r, spotifyBuildVersionRe); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+func findBuildVersionInFile(file string) string {
+	if match, _ := ScanFile(file, spotifyBuildVersionRe); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// findXpuiBuildVersion searches the xpui bundles, in the stock spa, its backup or the extracted folder
+func findXpuiBuildVersion(apps string) string {
+	for _, spa := range []string{"xpui.spa", "xpui.spa.bak"} {
+		if version := findBuildVersionInSpa(filepath.Join(apps, spa)); version != "" {
+			return version
+		}
+	}
+
+	bundles, _ := filepath.Glob(filepath.Join(apps, "xpui", "xpui*.js"))
+	for _, bundle := range bundles {
+		if version := findBuildVersionInFile(bundle); version != "" {
+			return version
+		}
+	}
+	return ""
+}
+
+func findBuildVersionInSpa(spa string) string {
+	r, err := zip.OpenReader(spa)
+	if err != nil {
+		return ""
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if ok, _ := path.Match("xpui*.js", f.Name); !ok {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		version := findBuildVersion(rc)
+		rc.Close()
+		if version != "" {
+			return version
+		}
+	}
+	return ""
+}
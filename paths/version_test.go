@@ -0,0 +1,99 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package paths
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const buildVersion = "1.2.31.1205.g4d59ad7c"
+
+func TestScan(t *testing.T) {
+	padding := func(n int) string { return strings.Repeat("x", n) }
+
+	for _, tt := range []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty", "", ""},
+		{"none", padding(3 * scanChunk), ""},
+		{"first chunk", "a " + buildVersion + " b", "1.2.31.1205"},
+		{"straddling chunks", padding(scanChunk-10) + " " + buildVersion + " ", "1.2.31.1205"},
+		{"later chunk", padding(2*scanChunk+100) + " " + buildVersion, "1.2.31.1205"},
+		// the window after the first chunk starts at 11.2.31.1205, whose tail must not match on its own
+		{"token cut by the window", padding(scanChunk-scanOverlap-1) + "x11.2.31.1205.g4d59ad7c" + padding(scanOverlap), ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := Scan(strings.NewReader(tt.content), spotifyBuildVersionRe)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			if match != nil {
+				got = match[1]
+			}
+			if got != tt.want {
+				t.Fatalf("Scan() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectSpotifyVersion(t *testing.T) {
+	writeXpui := func(t *testing.T, apps string, version string) {
+		t.Helper()
+		var buf bytes.Buffer
+		w := zip.NewWriter(&buf)
+		f, _ := w.Create("xpui.js")
+		f.Write([]byte(`const version="` + version + `";`))
+		w.Close()
+		if err := os.MkdirAll(apps, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(apps, "xpui.spa"), buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name              string
+		xpui, prefs, exec string
+		version, source   string
+	}{
+		{"xpui first", "1.2.40.1.gaaaaaaa", "1.2.30.1.gbbbbbbb", "1.2.20.1.gccccccc", "1.2.40.1", VersionSourceXpui},
+		{"prefs before exec", "", "1.2.30.1.gbbbbbbb", "1.2.20.1.gccccccc", "1.2.30.1", VersionSourcePrefs},
+		{"exec last", "", "", "1.2.20.1.gccccccc", "1.2.20.1", VersionSourceExec},
+		{"nothing", "", "", "", "", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			data, config := t.TempDir(), t.TempDir()
+			exec := filepath.Join(t.TempDir(), "spotify")
+			if tt.xpui != "" {
+				writeXpui(t, GetSpotifyAppsPath(data), tt.xpui)
+			}
+			if tt.prefs != "" {
+				os.WriteFile(filepath.Join(config, "prefs"), []byte(`app.last-launched-version="`+tt.prefs+`"`+"\n"), 0644)
+			}
+			if tt.exec != "" {
+				os.WriteFile(exec, []byte("\x00"+tt.exec+"\x00"), 0755)
+			}
+
+			version, source, err := DetectSpotifyVersion(data, exec, config)
+			if version != tt.version || source != tt.source {
+				t.Fatalf("DetectSpotifyVersion() = %q, %q, %v, want %q from %q", version, source, err, tt.version, tt.source)
+			}
+			if (err != nil) != (tt.version == "") {
+				t.Fatalf("DetectSpotifyVersion() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	ErrSchemeDenied   = errors.New("scheme not allowed")
+	ErrHostDenied     = errors.New("host not allowed")
+	ErrPrivateAddress = errors.New("private address not allowed")
+	ErrTooLarge       = errors.New("body too large")
+)
+
+type Config struct {
+	Schemes []string `mapstructure:"schemes"`
+	// AllowHosts restricts destinations to matching hosts when not empty, "*.example.com" matches every subdomain
+	AllowHosts []string `mapstructure:"allow-hosts"`
+	// DenyHosts takes precedence over AllowHosts
+	DenyHosts []string `mapstructure:"deny-hosts"`
+	// AllowPrivate lets destinations resolve to loopback, private and link-local addresses
+	AllowPrivate    bool  `mapstructure:"allow-private"`
+	MaxRequestSize  int64 `mapstructure:"max-request-size"`
+	MaxResponseSize int64 `mapstructure:"max-response-size"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Schemes:         []string{"http", "https"},
+		MaxRequestSize:  10 << 20,
+		MaxResponseSize: 100 << 20,
+	}
+}
+
+func LoadConfig(v *viper.Viper) (Config, error) {
+	config := DefaultConfig()
+	if err := v.UnmarshalKey("daemon-proxy", &config); err != nil {
+		return config, fmt.Errorf("invalid daemon-proxy config: %w", err)
+	}
+	return config, nil
+}
+
+// Policy decides which destinations the proxy may reach, its configuration can be swapped at any time with Configure
+type Policy struct {
+	config atomic.Pointer[Config]
+}
+
+func NewPolicy(config Config) *Policy {
+	p := &Policy{}
+	p.Configure(config)
+	return p
+}
+
+func (p *Policy) Configure(config Config) {
+	p.config.Store(&config)
+}
+
+func (p *Policy) Config() Config {
+	return *p.config.Load()
+}
+
+// CheckURL vets the scheme and host of u, along with its address when the host is an IP literal
+func (p *Policy) CheckURL(u *url.URL) error {
+	config := p.config.Load()
+
+	if !slices.Contains(config.Schemes, strings.ToLower(u.Scheme)) {
+		return fmt.Errorf("%w: %s", ErrSchemeDenied, u.Scheme)
+	}
+
+	hostname := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if hostname == "" {
+		return fmt.Errorf("%w: empty host", ErrHostDenied)
+	}
+	if slices.ContainsFunc(config.DenyHosts, func(pattern string) bool { return matchHost(pattern, hostname) }) {
+		return fmt.Errorf("%w: %s is denied", ErrHostDenied, hostname)
+	}
+	if len(config.AllowHosts) > 0 && !slices.ContainsFunc(config.AllowHosts, func(pattern string) bool { return matchHost(pattern, hostname) }) {
+		return fmt.Errorf("%w: %s isn't allowed", ErrHostDenied, hostname)
+	}
+
+	if addr, err := netip.ParseAddr(hostname); err == nil {
+		return p.checkAddr(config, addr)
+	}
+	return nil
+}
+
+// Control vets the resolved address of every connection, so that DNS can't point an allowed host at a private address
+func (p *Policy) Control(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	return p.checkAddr(p.config.Load(), addr)
+}
+
+func (p *Policy) checkAddr(config *Config, addr netip.Addr) error {
+	if config.AllowPrivate || !isPrivate(addr) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrPrivateAddress, addr)
+}
+
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func isPrivate(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() ||
+		sharedAddressSpace.Contains(addr)
+}
+
+func matchHost(pattern string, hostname string) bool {
+	pattern = strings.ToLower(pattern)
+	if pattern == hostname {
+		return true
+	}
+	if strings.HasPrefix(pattern, "*.") {
+		ok, _ := path.Match(pattern, hostname)
+		return ok
+	}
+	return false
+}
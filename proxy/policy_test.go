@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package proxy
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestCheckURL(t *testing.T) {
+	config := DefaultConfig()
+	config.AllowHosts = []string{"*.example.com", "example.org", "127.0.0.1"}
+	config.DenyHosts = []string{"evil.example.com"}
+	policy := NewPolicy(config)
+
+	for _, tt := range []struct {
+		url  string
+		want error
+	}{
+		{"https://api.example.com/x", nil},
+		{"https://EXAMPLE.org./x", nil},
+		{"https://example.com/x", ErrHostDenied},
+		{"https://evil.example.com/x", ErrHostDenied},
+		{"https://example.net/x", ErrHostDenied},
+		{"ftp://example.org/x", ErrSchemeDenied},
+		{"file:///etc/passwd", ErrSchemeDenied},
+		{"https:///x", ErrHostDenied},
+		{"http://127.0.0.1/x", ErrPrivateAddress},
+	} {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := policy.CheckURL(u); !errors.Is(err, tt.want) {
+			t.Errorf("CheckURL(%s) = %v, want %v", tt.url, err, tt.want)
+		}
+	}
+}
+
+func TestCheckURLPrivateAddresses(t *testing.T) {
+	policy := NewPolicy(DefaultConfig())
+
+	for _, host := range []string{
+		"127.0.0.1",
+		"[::1]",
+		"10.0.0.1",
+		"172.16.0.1",
+		"192.168.1.1",
+		"169.254.169.254",
+		"100.64.0.1",
+		"0.0.0.0",
+		"[::ffff:127.0.0.1]",
+		"[fe80::1]",
+		"[fd00::1]",
+	} {
+		u := &url.URL{Scheme: "http", Host: host}
+		if err := policy.CheckURL(u); !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("CheckURL(%s) = %v, want ErrPrivateAddress", u, err)
+		}
+	}
+
+	u := &url.URL{Scheme: "http", Host: "93.184.215.14"}
+	if err := policy.CheckURL(u); err != nil {
+		t.Errorf("CheckURL(%s) = %v, want no error", u, err)
+	}
+
+	config := DefaultConfig()
+	config.AllowPrivate = true
+	policy.Configure(config)
+	u = &url.URL{Scheme: "http", Host: "127.0.0.1"}
+	if err := policy.CheckURL(u); err != nil {
+		t.Errorf("CheckURL(%s) with allow-private = %v, want no error", u, err)
+	}
+}
+
+func TestControl(t *testing.T) {
+	policy := NewPolicy(DefaultConfig())
+
+	for _, address := range []string{"127.0.0.1:80", "[::1]:443", "10.1.2.3:8080"} {
+		if err := policy.Control("tcp", address, nil); !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("Control(%s) = %v, want ErrPrivateAddress", address, err)
+		}
+	}
+	if err := policy.Control("tcp", "93.184.215.14:443", nil); err != nil {
+		t.Errorf("Control() = %v, want no error", err)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// Handler forwards requests for <Prefix><url> to url, within the limits of Policy
+type Handler struct {
+	Prefix    string
+	Policy    *Policy
+	Transport http.RoundTripper
+	// StripHeaders are removed from requests before they're forwarded
+	StripHeaders []string
+	Logger       *log.Logger
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	dest, err := h.destination(r.URL.Path)
+	if err != nil {
+		h.Logger.Warn("refused", "method", r.Method, "path", r.URL.Path, "err", err)
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+
+	config := h.Policy.Config()
+	if r.ContentLength > config.MaxRequestSize {
+		h.Logger.Warn("refused", "method", r.Method, "host", dest.Host, "err", ErrTooLarge)
+		http.Error(w, ErrTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if r.Body != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, config.MaxRequestSize)
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Transport: h.Transport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL = dest
+			pr.Out.Host = ""
+			for _, header := range h.StripHeaders {
+				pr.Out.Header.Del(header)
+			}
+			setHeaders(pr.Out.Header, pr.In.Header.Get("X-Set-Headers"))
+		},
+		ModifyResponse: func(res *http.Response) error {
+			if res.ContentLength > config.MaxResponseSize {
+				return errResponseTooLarge
+			}
+			// ReverseProxy needs the body of an upgraded connection as an io.ReadWriteCloser, these streams aren't limited
+			if res.StatusCode != http.StatusSwitchingProtocols {
+				res.Body = &limitedBody{ReadCloser: res.Body, remaining: config.MaxResponseSize}
+			}
+			h.Logger.Info("proxied", "method", r.Method, "host", dest.Host, "path", dest.Path, "status", res.StatusCode)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+			h.Logger.Warn("failed", "method", r.Method, "host", dest.Host, "path", dest.Path, "err", err)
+			http.Error(w, err.Error(), statusOf(err))
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// destination parses the url following the prefix of path and vets it against the policy
+func (h *Handler) destination(path string) (*url.URL, error) {
+	p, ok := strings.CutPrefix(path, h.Prefix)
+	if !ok {
+		return nil, fmt.Errorf("invalid path %s", path)
+	}
+	u, err := url.Parse(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination: %w", err)
+	}
+	if err := h.Policy.CheckURL(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// setHeaders applies the JSON object of headers to set, where "undefined" removes the header
+func setHeaders(header http.Header, xSetHeaders string) {
+	header.Del("X-Set-Headers")
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(xSetHeaders), &headers); err != nil {
+		return
+	}
+	for k, v := range headers {
+		if v == "undefined" {
+			header.Del(k)
+		} else {
+			header.Set(k, v)
+		}
+	}
+}
+
+func statusOf(err error) int {
+	var maxBytes *http.MaxBytesError
+	switch {
+	case errors.Is(err, ErrSchemeDenied), errors.Is(err, ErrHostDenied), errors.Is(err, ErrPrivateAddress):
+		return http.StatusForbidden
+	case errors.Is(err, ErrTooLarge), errors.As(err, &maxBytes):
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadGateway
+}
+
+// errResponseTooLarge is the destination's fault, the proxy answers it with a bad gateway
+var errResponseTooLarge = errors.New("response body too large")
+
+// limitedBody fails once more than remaining bytes are read, cutting off the response
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	// reading a byte past the limit tells a body of exactly remaining bytes from a larger one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		n, b.remaining = int(b.remaining), 0
+		return n, errResponseTooLarge
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
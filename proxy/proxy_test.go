@@ -0,0 +1,242 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// newTestProxy serves a Handler for policy whose transport vets connections with policy.Control like the daemon's
+func newTestProxy(t *testing.T, policy *Policy) *httptest.Server {
+	t.Helper()
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: policy.Control}
+	handler := &Handler{
+		Prefix:       "/proxy/",
+		Policy:       policy,
+		Transport:    &http.Transport{DialContext: dialer.DialContext},
+		StripHeaders: []string{"X-Token"},
+		Logger:       log.New(io.Discard),
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestDestination(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func privateConfig() Config {
+	config := DefaultConfig()
+	config.AllowPrivate = true
+	return config
+}
+
+func TestHandlerForwards(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	dest := newTestDestination(t, func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		w.Write([]byte("ok"))
+	})
+	srv := newTestProxy(t, NewPolicy(privateConfig()))
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/proxy/"+dest.URL+"/path", nil)
+	req.Header.Set("X-Token", "secret")
+	req.Header.Set("X-Set-Headers", `{"Referer":"https://example.com","User-Agent":"undefined"}`)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+
+	if res.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("got %d %q, want 200 \"ok\"", res.StatusCode, body)
+	}
+	got := <-requests
+	if got.URL.Path != "/path" {
+		t.Errorf("destination path = %s, want /path", got.URL.Path)
+	}
+	if got.Header.Get("X-Token") != "" {
+		t.Error("stripped header was forwarded")
+	}
+	if got.Header.Get("X-Set-Headers") != "" || got.Header.Get("User-Agent") != "" || got.Header.Get("Referer") != "https://example.com" {
+		t.Errorf("X-Set-Headers not applied: %v", got.Header)
+	}
+}
+
+func TestHandlerRefusesDestinations(t *testing.T) {
+	var reached atomic.Bool
+	dest := newTestDestination(t, func(w http.ResponseWriter, r *http.Request) {
+		reached.Store(true)
+	})
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(dest.URL, "http://"))
+
+	config := DefaultConfig()
+	config.DenyHosts = []string{"denied.example"}
+	srv := newTestProxy(t, NewPolicy(config))
+
+	for _, tt := range []struct {
+		name string
+		dest string
+		want int
+	}{
+		{"loopback literal", dest.URL, http.StatusForbidden},
+		{"ipv6 loopback literal", "http://[::1]:" + port, http.StatusForbidden},
+		{"private literal", "http://192.168.0.1:" + port, http.StatusForbidden},
+		{"denied host", "http://denied.example", http.StatusForbidden},
+		{"scheme", "file:///etc/passwd", http.StatusForbidden},
+		// the hostname passes CheckURL, the dial control refuses the loopback address it resolves to
+		{"resolving to loopback", "http://localhost:" + port, http.StatusForbidden},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := http.Get(srv.URL + "/proxy/" + tt.dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+
+			if res.StatusCode != tt.want {
+				t.Errorf("got %d %q, want %d", res.StatusCode, body, tt.want)
+			}
+		})
+	}
+	if reached.Load() {
+		t.Fatal("a refused request reached the destination")
+	}
+}
+
+func TestHandlerRequestLimit(t *testing.T) {
+	var received atomic.Int64
+	dest := newTestDestination(t, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received.Store(int64(len(b)))
+	})
+	config := privateConfig()
+	config.MaxRequestSize = 16
+	srv := newTestProxy(t, NewPolicy(config))
+
+	post := func(body io.Reader) int {
+		t.Helper()
+		res, err := http.Post(srv.URL+"/proxy/"+dest.URL, "text/plain", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	if status := post(strings.NewReader(strings.Repeat("a", 16))); status != http.StatusOK || received.Load() != 16 {
+		t.Fatalf("body at the limit: got %d with %d bytes received", status, received.Load())
+	}
+
+	received.Store(0)
+	if status := post(strings.NewReader(strings.Repeat("a", 17))); status != http.StatusRequestEntityTooLarge || received.Load() != 0 {
+		t.Fatalf("declared body over the limit: got %d with %d bytes received", status, received.Load())
+	}
+
+	// without a content length the limit is enforced while the body streams
+	received.Store(0)
+	if status := post(io.MultiReader(strings.NewReader(strings.Repeat("a", 64)))); status != http.StatusRequestEntityTooLarge || received.Load() > 16 {
+		t.Fatalf("streamed body over the limit: got %d with %d bytes received", status, received.Load())
+	}
+}
+
+func TestHandlerResponseLimit(t *testing.T) {
+	dest := newTestDestination(t, func(w http.ResponseWriter, r *http.Request) {
+		n := 16
+		if strings.HasPrefix(r.URL.Path, "/over") {
+			n = 64
+		}
+		if strings.HasSuffix(r.URL.Path, "/stream") {
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte(strings.Repeat("a", n)))
+	})
+	config := privateConfig()
+	config.MaxResponseSize = 16
+	srv := newTestProxy(t, NewPolicy(config))
+
+	get := func(path string) (int, []byte, error) {
+		t.Helper()
+		res, err := http.Get(srv.URL + "/proxy/" + dest.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		return res.StatusCode, body, err
+	}
+
+	if status, body, err := get("/"); status != http.StatusOK || len(body) != 16 || err != nil {
+		t.Fatalf("body at the limit: got %d with %d bytes, %v", status, len(body), err)
+	}
+	if status, body, _ := get("/over"); status != http.StatusBadGateway {
+		t.Fatalf("declared body over the limit: got %d %q, want 502", status, body)
+	}
+	// the headers are already sent when a streamed body crosses the limit, so the response is cut off
+	if _, body, err := get("/over/stream"); err == nil || len(body) > 16 {
+		t.Fatalf("streamed body over the limit: got %d bytes, %v", len(body), err)
+	}
+}
+
+func TestHandlerUpgrades(t *testing.T) {
+	dest := newTestDestination(t, func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		rw.Flush()
+		io.Copy(conn, rw)
+	})
+	config := privateConfig()
+	config.MaxResponseSize = 16
+	srv := newTestProxy(t, NewPolicy(config))
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/proxy/"+dest.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "echo")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(res.Body)
+		t.Fatalf("got %d %q, want 101", res.StatusCode, body)
+	}
+	conn, ok := res.Body.(io.ReadWriteCloser)
+	if !ok {
+		t.Fatalf("body of the upgraded connection is a %T", res.Body)
+	}
+
+	// the stream isn't a response body, the response limit doesn't apply to it
+	message := strings.Repeat("a", 4*int(config.MaxResponseSize))
+	if _, err := conn.Write([]byte(message)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(message))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != message {
+		t.Fatalf("echoed %q, %v", buf, err)
+	}
+}
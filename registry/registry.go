@@ -0,0 +1,308 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package registry
+
+import (
+	"archive/zip"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Delusoire/bespoke-cli/v3/module"
+	"github.com/Delusoire/bespoke-cli/v3/paths"
+	"github.com/charmbracelet/log"
+)
+
+const IndexFile = "index.json"
+
+type Entry struct {
+	Id       module.ModuleIdentifier `json:"id"`
+	Version  module.Version          `json:"version"`
+	Artifact string                  `json:"artifact"`
+	Metadata module.Metadata         `json:"metadata"`
+	Checksum string                  `json:"checksum"`
+	Size     int64                   `json:"size"`
+}
+
+type Index struct {
+	Generated time.Time `json:"generated"`
+	Modules   []Entry   `json:"modules"`
+}
+
+func sidecarPath(zipPath string) string {
+	return strings.TrimSuffix(zipPath, ".zip") + ".metadata.json"
+}
+
+func artifactPath(dir string, metadata module.Metadata) (string, error) {
+	if err := metadata.Validate(); err != nil {
+		return "", err
+	}
+	return paths.Within(dir, filepath.FromSlash(string(metadata.GetModuleIdentifier())), metadata.Version+".zip")
+}
+
+func readArtifactMetadata(zipPath string) (module.Metadata, error) {
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return module.Metadata{}, err
+	}
+	defer r.Close()
+
+	f, err := r.Open("metadata.json")
+	if err != nil {
+		return module.Metadata{}, fmt.Errorf("%s has no metadata.json at its root: %w", zipPath, err)
+	}
+	defer f.Close()
+
+	metadata, err := module.ParseMetadata(f)
+	if err != nil {
+		return module.Metadata{}, err
+	}
+	if err := metadata.Validate(); err != nil {
+		return module.Metadata{}, fmt.Errorf("invalid metadata in %s: %w", zipPath, err)
+	}
+	return metadata, nil
+}
+
+func checksumFile(p string) (string, int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func writeJson(p string, v any) error {
+	content, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, content, 0644)
+}
+
+// BuildIndex scans dir for module zips, refreshes their metadata sidecars and writes the index.
+// Zips which aren't valid modules are logged and left out of the index
+func BuildIndex(dir string, logger *log.Logger) (*Index, error) {
+	index := &Index{Generated: time.Now().UTC(), Modules: []Entry{}}
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, ".zip") {
+			return nil
+		}
+
+		metadata, err := readArtifactMetadata(p)
+		if err != nil {
+			logger.Warn("Skipping invalid module zip", "path", p, "err", err)
+			return nil
+		}
+		if err := writeJson(sidecarPath(p), metadata); err != nil {
+			return err
+		}
+
+		checksum, size, err := checksumFile(p)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		index.Modules = append(index.Modules, Entry{
+			Id:       metadata.GetModuleIdentifier(),
+			Version:  module.Version(metadata.Version),
+			Artifact: filepath.ToSlash(rel),
+			Metadata: metadata,
+			Checksum: checksum,
+			Size:     size,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(index.Modules, func(i, j int) bool {
+		a, b := index.Modules[i], index.Modules[j]
+		if a.Id != b.Id {
+			return a.Id < b.Id
+		}
+		return compareVersions(string(a.Version), string(b.Version)) < 0
+	})
+
+	return index, writeJson(filepath.Join(dir, IndexFile), index)
+}
+
+// compareVersions orders semantic versions by precedence, falling back to comparing them as strings
+// when either isn't one
+func compareVersions(a string, b string) int {
+	va, okA := parseSemver(a)
+	vb, okB := parseSemver(b)
+	if !okA || !okB {
+		return strings.Compare(a, b)
+	}
+
+	for i := 0; i < max(len(va.core), len(vb.core)); i++ {
+		if c := cmp.Compare(va.part(i), vb.part(i)); c != 0 {
+			return c
+		}
+	}
+
+	// a prerelease precedes its release
+	switch {
+	case len(va.pre) == 0 && len(vb.pre) == 0:
+		return 0
+	case len(va.pre) == 0:
+		return 1
+	case len(vb.pre) == 0:
+		return -1
+	}
+	for i := 0; i < min(len(va.pre), len(vb.pre)); i++ {
+		if c := comparePrerelease(va.pre[i], vb.pre[i]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(va.pre), len(vb.pre))
+}
+
+type semver struct {
+	core []int
+	pre  []string
+}
+
+func (v semver) part(i int) int {
+	if i < len(v.core) {
+		return v.core[i]
+	}
+	return 0
+}
+
+// parseSemver reads major.minor.patch[-prerelease][+build], tolerating a leading v and missing parts
+func parseSemver(s string) (semver, bool) {
+	s, _, _ = strings.Cut(strings.TrimPrefix(s, "v"), "+")
+	core, pre, hasPre := strings.Cut(s, "-")
+
+	var v semver
+	for _, part := range strings.Split(core, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return semver{}, false
+		}
+		v.core = append(v.core, n)
+	}
+	if hasPre {
+		v.pre = strings.Split(pre, ".")
+		for _, id := range v.pre {
+			if id == "" {
+				return semver{}, false
+			}
+		}
+	}
+	return v, true
+}
+
+// comparePrerelease orders numeric identifiers numerically and before alphanumeric ones, which compare as strings
+func comparePrerelease(a string, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return cmp.Compare(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// Add copies a module zip into dir at author/name/version.zip and refreshes the index
+func Add(dir string, zipPath string, force bool, logger *log.Logger) (module.StoreIdentifier, error) {
+	metadata, err := readArtifactMetadata(zipPath)
+	if err != nil {
+		return module.StoreIdentifier{}, err
+	}
+	identifier := metadata.GetStoreIdentifier()
+
+	dest, err := artifactPath(dir, metadata)
+	if err != nil {
+		return identifier, err
+	}
+	if _, err := os.Stat(dest); err == nil && !force {
+		return identifier, errors.New(identifier.String() + " is already in the registry")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return identifier, err
+	}
+	if err := copyFile(zipPath, dest); err != nil {
+		return identifier, err
+	}
+
+	_, err = BuildIndex(dir, logger)
+	return identifier, err
+}
+
+func copyFile(src string, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dest + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// Handler serves the index, artifacts and metadata sidecars of dir, answering Range requests
+func Handler(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean(r.URL.Path)
+		if name != "/"+IndexFile && !strings.HasSuffix(name, ".zip") && !strings.HasSuffix(name, ".metadata.json") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		files.ServeHTTP(w, r)
+	})
+}
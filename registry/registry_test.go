@@ -0,0 +1,212 @@
+/*
+ * Copyright (C) 2024 Delusoire
+ * SPDX-License-Identifier: GPL-3.0-or-later
+ */
+
+package registry
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Delusoire/bespoke-cli/v3/module"
+	"github.com/charmbracelet/log"
+)
+
+func TestCompareVersions(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.9.0", "1.10.0", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"2.0.0", "10.0.0", -1},
+		{"1.0", "1.0.0", 0},
+		{"v1.2.0", "1.10.0", -1},
+		{"1.0.0+build.5", "1.0.0+build.1", 0},
+		{"1.0.0-alpha", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-beta.11", "1.0.0-rc.1", -1},
+		{"latest", "1.0.0", 1},
+		{"nightly", "latest", 1},
+	} {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := compareVersions(tt.b, tt.a); got != -tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func moduleZip(t *testing.T, metadata *module.Metadata) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if metadata != nil {
+		w, err := zw.Create("metadata.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.NewEncoder(w).Encode(metadata); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := zw.Create("index.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("export default {}"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func metadata(author string, name string, version string) *module.Metadata {
+	return &module.Metadata{Name: name, Version: version, Authors: []string{author}}
+}
+
+func writeFile(t *testing.T, p string, content []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildIndex(t *testing.T) {
+	dir := t.TempDir()
+	versions := []string{"1.10.0", "1.9.0", "1.0.0", "1.0.0-beta.2"}
+	for _, version := range versions {
+		writeFile(t, filepath.Join(dir, "a", "m", version+".zip"), moduleZip(t, metadata("a", "m", version)))
+	}
+	writeFile(t, filepath.Join(dir, "0", "first", "1.0.0.zip"), moduleZip(t, metadata("0", "first", "1.0.0")))
+	writeFile(t, filepath.Join(dir, "broken.zip"), []byte("not a zip"))
+	writeFile(t, filepath.Join(dir, "nometadata.zip"), moduleZip(t, nil))
+	writeFile(t, filepath.Join(dir, "invalid.zip"), moduleZip(t, metadata("a", "..", "1.0.0")))
+
+	var logs bytes.Buffer
+	index, err := BuildIndex(dir, log.New(&logs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, entry := range index.Modules {
+		got = append(got, string(entry.Id)+"@"+string(entry.Version))
+	}
+	want := []string{"0/first@1.0.0", "a/m@1.0.0-beta.2", "a/m@1.0.0", "a/m@1.9.0", "a/m@1.10.0"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("indexed %q, want %q", got, want)
+	}
+	for _, skipped := range []string{"broken.zip", "nometadata.zip", "invalid.zip"} {
+		if !strings.Contains(logs.String(), skipped) {
+			t.Errorf("skipping %s wasn't logged: %s", skipped, logs.String())
+		}
+	}
+
+	entry := index.Modules[len(index.Modules)-1]
+	content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(entry.Artifact)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	if entry.Checksum != hex.EncodeToString(sum[:]) || entry.Size != int64(len(content)) {
+		t.Fatalf("entry %s has checksum %s and size %d", entry.Artifact, entry.Checksum, entry.Size)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a", "m", "1.10.0.metadata.json")); err != nil {
+		t.Fatalf("metadata sidecar wasn't written: %v", err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, IndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written Index
+	if err := json.Unmarshal(raw, &written); err != nil {
+		t.Fatal(err)
+	}
+	if len(written.Modules) != len(want) {
+		t.Fatalf("%s lists %d modules, want %d", IndexFile, len(written.Modules), len(want))
+	}
+}
+
+func TestAdd(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "module.zip")
+	writeFile(t, src, moduleZip(t, metadata("a", "m", "1.0.0")))
+	dir := t.TempDir()
+	logger := log.New(io.Discard)
+
+	identifier, err := Add(dir, src, false, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identifier.String() != "a/m@1.0.0" {
+		t.Fatalf("Add() = %s", identifier)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a", "m", "1.0.0.zip")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Add(dir, src, false, logger); err == nil {
+		t.Fatal("Add() of a version already in the registry succeeded")
+	}
+	if _, err := Add(dir, src, true, logger); err != nil {
+		t.Fatalf("Add() with force = %v", err)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.zip")
+	writeFile(t, bad, moduleZip(t, metadata("a", "m", "../1.0.0")))
+	if _, err := Add(dir, bad, false, logger); err == nil {
+		t.Fatal("Add() of a zip with an invalid version succeeded")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a", "m", "1.0.0.zip"), moduleZip(t, metadata("a", "m", "1.0.0")))
+	writeFile(t, filepath.Join(dir, "secret.txt"), []byte("secret"))
+	if _, err := BuildIndex(dir, log.New(io.Discard)); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(Handler(dir))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		path   string
+		status int
+	}{
+		{"/" + IndexFile, http.StatusOK},
+		{"/a/m/1.0.0.zip", http.StatusOK},
+		{"/a/m/1.0.0.metadata.json", http.StatusOK},
+		{"/secret.txt", http.StatusNotFound},
+		{"/a/m/", http.StatusNotFound},
+	} {
+		res, err := http.Get(srv.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.path, res.StatusCode, tt.status)
+		}
+	}
+}